@@ -0,0 +1,174 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/elastic/apm-tools/pkg/apmclient"
+)
+
+type agentReport struct {
+	apmclient.AgentSummary
+	MinVersion string `json:"min_version,omitempty"`
+	Outdated   bool   `json:"outdated"`
+}
+
+func (cmd *Commands) agentsCommand(ctx context.Context, c *cli.Command) error {
+	client, err := cmd.getClient()
+	if err != nil {
+		return err
+	}
+	agents, err := client.AgentSummary(ctx, sinceOptions(c)...)
+	if err != nil {
+		return err
+	}
+
+	minVersions := c.StringMap("min-version")
+	reports := make([]agentReport, len(agents))
+	for i, agent := range agents {
+		reports[i] = agentReport{AgentSummary: agent}
+		if min, ok := minVersions[agent.AgentName]; ok {
+			reports[i].MinVersion = min
+			reports[i].Outdated = compareVersions(agent.AgentVersion, min) < 0
+		}
+	}
+	if c.Bool("outdated") {
+		filtered := reports[:0]
+		for _, r := range reports {
+			if r.Outdated {
+				filtered = append(filtered, r)
+			}
+		}
+		reports = filtered
+	}
+
+	switch format := c.String("format"); format {
+	case "json":
+		return printJSON(reports)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		if err := w.Write(agentReportColumns); err != nil {
+			return err
+		}
+		for _, r := range reports {
+			if err := w.Write(r.row()); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	case "table":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(agentReportColumns, "\t")))
+		for _, r := range reports {
+			fmt.Fprintln(tw, strings.Join(r.row(), "\t"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+var agentReportColumns = []string{
+	"service", "environment",
+	"agent", "agent_version",
+	"language", "language_version",
+	"runtime", "runtime_version",
+	"sdk", "sdk_language", "sdk_version",
+	"docs", "min_version", "outdated",
+}
+
+func (r agentReport) row() []string {
+	return []string{
+		r.ServiceName, r.Environment,
+		r.AgentName, r.AgentVersion,
+		r.LanguageName, r.LanguageVersion,
+		r.RuntimeName, r.RuntimeVersion,
+		r.SDKName, r.SDKLanguage, r.SDKVersion,
+		strconv.FormatInt(r.DocCount, 10), r.MinVersion, strconv.FormatBool(r.Outdated),
+	}
+}
+
+// compareVersions compares two dotted version strings numerically,
+// returning -1, 0, or 1. Any pre-release or build suffix is ignored,
+// and non-numeric components compare as zero.
+func compareVersions(a, b string) int {
+	split := func(v string) []string {
+		v = strings.TrimPrefix(v, "v")
+		if i := strings.IndexAny(v, "-+"); i >= 0 {
+			v = v[:i]
+		}
+		return strings.Split(v, ".")
+	}
+	as, bs := split(a), split(b)
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var an, bn int
+		if i < len(as) {
+			an, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			bn, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+	}
+	return 0
+}
+
+// NewAgentsCmd returns pointer to a Command that reports agents and their versions per service
+func NewAgentsCmd(commands *Commands) *cli.Command {
+	return &cli.Command{
+		Name:   "agents",
+		Usage:  "report APM agent and OpenTelemetry SDK versions per service and environment",
+		Action: commands.agentsCommand,
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:  "since",
+				Usage: "only consider data received within this duration. 0 means no time limit.",
+				Value: 24 * time.Hour,
+			},
+			&cli.StringMapFlag{
+				Name:  "min-version",
+				Usage: "minimum supported version for an agent, in the form agent.name=version (e.g. java=1.50.0). May be repeated.",
+			},
+			&cli.BoolFlag{
+				Name:  "outdated",
+				Usage: "only report agents below their minimum version",
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "set the output format to one of: table, json, csv",
+				Value: "table",
+			},
+		},
+	}
+}
@@ -0,0 +1,45 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		a, b   string
+		expect int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.2", "1.2.0", 0},
+		{"1.2", "1.2.1", -1},
+		{"2.0.0-beta1", "2.0.0", 0},
+		{"1.50.0+build.5", "1.49.9", 1},
+		{"1.x.0", "1.0.0", 0},
+		{"", "0.0.1", -1},
+	} {
+		assert.Equal(t, test.expect, compareVersions(test.a, test.b), "compareVersions(%q, %q)", test.a, test.b)
+		assert.Equal(t, -test.expect, compareVersions(test.b, test.a), "compareVersions(%q, %q)", test.b, test.a)
+	}
+}
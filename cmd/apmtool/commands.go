@@ -18,7 +18,11 @@
 package main
 
 import (
+	"context"
+	"log"
+
 	"github.com/elastic/apm-tools/pkg/apmclient"
+	"github.com/elastic/apm-tools/pkg/espoll"
 )
 
 type Commands struct {
@@ -28,3 +32,26 @@ type Commands struct {
 func (cmd *Commands) getClient() (*apmclient.Client, error) {
 	return apmclient.New(cmd.cfg)
 }
+
+// getIndices returns the index patterns for querying APM data,
+// logging a warning if Kibana's APM index settings could not be used.
+func (cmd *Commands) getIndices(ctx context.Context) (apmclient.Indices, error) {
+	client, err := cmd.getClient()
+	if err != nil {
+		return apmclient.Indices{}, err
+	}
+	indices, err := client.Indices(ctx)
+	if err != nil {
+		return apmclient.Indices{}, err
+	}
+	if indices.Warning != "" {
+		log.Printf("warning: %s; using default APM indices", indices.Warning)
+	}
+	return indices, nil
+}
+
+// getESPollClient returns an espoll.Client configured with
+// the same Elasticsearch settings as getClient.
+func (cmd *Commands) getESPollClient() (*espoll.Client, error) {
+	return espoll.NewClient(cmd.cfg)
+}
@@ -19,96 +19,217 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/urfave/cli/v3"
 
 	"github.com/elastic/apm-tools/pkg/espoll"
-	"github.com/elastic/go-elasticsearch/v8"
 )
 
-var maxElasticsearchBackoff = 10 * time.Second
+// Exit codes returned by the espoll command.
+const (
+	exitCodeError      = 1
+	exitCodeTimeout    = 2
+	exitCodeAssertion  = 3
+	exitCodeConnection = 4
+)
 
 type config struct {
-	query      string
-	esURL      string
-	esUsername string
-	esPassword string
-
-	tlsSkipVerify bool
+	query string
 
 	target  string
 	timeout time.Duration
 	hits    uint64
+	stream  bool
+	quiet   bool
+
+	watch         bool
+	watchInterval time.Duration
+	watchLookback time.Duration
+	maxCount      uint64
+
+	format  string
+	fields  []string
+	extract string
+
+	diagnose bool
+	expect   expectations
 }
 
 func (cmd *Commands) pollDocs(ctx context.Context, c *cli.Command) error {
+	expect, err := newExpectations(c)
+	if err != nil {
+		return cli.Exit(err, exitCodeError)
+	}
+	if esql := c.String("esql"); esql != "" {
+		return exitError(cmd.pollESQL(ctx, c, esql, expect))
+	}
 	cfg := config{
-		query:      c.String("query"),
-		esURL:      cmd.cfg.ElasticsearchURL,
-		esUsername: cmd.cfg.Username,
-		esPassword: cmd.cfg.Password,
-
-		tlsSkipVerify: cmd.cfg.TLSSkipVerify,
+		query: c.String("query"),
 
 		target:  c.String("target"),
 		timeout: c.Duration("timeout"),
 		hits:    c.Uint("min-hits"),
+		stream:  c.Bool("stream"),
+		quiet:   c.Bool("quiet"),
+
+		watch:         c.Bool("watch"),
+		watchInterval: c.Duration("interval"),
+		watchLookback: c.Duration("lookback"),
+		maxCount:      c.Uint("max-count"),
+
+		format:  c.String("format"),
+		fields:  c.StringSlice("fields"),
+		extract: c.String("extract"),
+
+		diagnose: c.Bool("diagnose"),
+		expect:   expect,
 	}
-	query := c.String("query")
-	if query == "" {
-		stat, err := os.Stdin.Stat()
-		if err != nil {
-			log.Fatalf("failed to stat stdin: %s", err.Error())
+	if cfg.watch && (cfg.stream || expect.any()) {
+		return cli.Exit("--watch cannot be combined with --stream, --expect* or --max-hits", exitCodeError)
+	}
+	if expect.count != nil && !c.IsSet("min-hits") {
+		// Wait for the expected number of documents,
+		// and then check there are no more than that.
+		cfg.hits = uint64(*expect.count)
+	}
+	// Resolve the query before the default target, which may
+	// require a request to Kibana, so that invalid query flags
+	// are reported without making any requests.
+	generated, err := generateQuery(c)
+	if err != nil {
+		return err
+	}
+	if generated != "" {
+		if cfg.query != "" {
+			return errors.New("--query cannot be combined with --kql, --query-file or --named-query")
+		}
+		cfg.query = generated
+		if c.Bool("verbose") {
+			log.Println("generated query:", cfg.query)
 		}
-		if stat.Size() == 0 {
-			log.Fatal("empty -query flag and stdin, please set one.")
+	} else if cfg.query == "" {
+		if cfg.query, err = readStdinQuery(os.Stdin); err != nil {
+			return err
 		}
+	}
 
-		b, err := io.ReadAll(os.Stdin)
+	if cfg.target == "" {
+		indices, err := cmd.getIndices(ctx)
 		if err != nil {
-			log.Fatalf("failed to read stdin: %s", err.Error())
+			return exitError(err)
 		}
-		query = string(strings.Trim(string(b), "\n"))
+		cfg.target = indices.All()
 	}
 
-	log.Println("query:", query)
+	if generated == "" && !cfg.quiet {
+		log.Println("query:", cfg.query)
+	}
 
 	ctxMain, cancel := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
 	defer cancel()
 
-	if err := Main(ctxMain, cfg); err != nil {
-		log.Fatalf("ERROR: %s", err.Error())
+	esClient, err := cmd.getESPollClient()
+	if err != nil {
+		return err
 	}
+	return exitError(Main(ctxMain, esClient, cfg))
+}
 
-	return nil
+// generateQuery returns the query parsed from --kql, or rendered from
+// --query-file or --named-query with the --var variables, or "" if none
+// of these are set.
+func generateQuery(c *cli.Command) (string, error) {
+	kql, file, name := c.String("kql"), c.String("query-file"), c.String("named-query")
+	var text string
+	switch {
+	case kql != "" && (file != "" || name != ""):
+		return "", errors.New("--kql cannot be combined with --query-file or --named-query")
+	case kql != "":
+		q, err := espoll.ParseKQL(kql)
+		if err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(q)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	case file != "" && name != "":
+		return "", errors.New("--query-file and --named-query cannot both be set")
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		text, name = string(data), filepath.Base(file)
+	case name != "":
+		var err error
+		if text, err = builtinQuery(name); err != nil {
+			return "", err
+		}
+	default:
+		return "", nil
+	}
+	return renderQuery(name, text, c.StringMap("var"))
 }
 
 // NewESPollCmd returns pointer to Command that queries documents from Elasticsearch
 func NewESPollCmd(commands *Commands) *cli.Command {
 	return &cli.Command{
-		Name:   "espoll",
-		Usage:  "poll documents from Elasticsearch",
+		Name:  "espoll",
+		Usage: "poll documents from Elasticsearch",
+		Description: fmt.Sprintf(`Poll Elasticsearch until a query matches at least --min-hits documents,
+and optionally check the results with the --expect* and --max-hits flags.
+
+Exit codes:
+  %d  other errors
+  %d  timed out waiting for matching documents
+  %d  an expectation was not met
+  %d  failed to connect to Elasticsearch`,
+			exitCodeError, exitCodeTimeout, exitCodeAssertion, exitCodeConnection,
+		),
 		Action: commands.pollDocs,
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:  "query",
 				Usage: "The Elasticsearch query in Query DSL. Must be set via this flag or stdin.",
 			},
+			&cli.StringFlag{
+				Name:  "kql",
+				Usage: `A Kibana Query Language query to use instead of --query, e.g. 'service.name:foo and transaction.duration.us > 1000000'.`,
+			},
+			&cli.StringFlag{
+				Name:  "query-file",
+				Usage: "Read the query from a Go template file. See --var for setting template variables.",
+			},
+			&cli.StringFlag{
+				Name:  "named-query",
+				Usage: fmt.Sprintf("Use a built-in query template, one of: %s.", strings.Join(builtinQueryNames(), ", ")),
+			},
+			&cli.StringMapFlag{
+				Name: "var",
+				Usage: "Set a query template variable, as name=value. May be repeated. " +
+					`Templates may use {{json .name}} to encode variables, {{get "name" "default"}} for optional variables, ` +
+					`and now, ago, add, rfc3339 and unixMillis for time math, e.g. {{ago "15m" | json}}.`,
+			},
 			&cli.StringFlag{
 				Name:  "target",
-				Value: "traces-*,logs-*,metrics-*",
-				Usage: "Comma-separated list of data streams, indices, and aliases to search (Supports wildcards (*)).",
+				Usage: "Comma-separated list of data streams, indices, and aliases to search (Supports wildcards (*)). Defaults to all APM indices.",
 			},
 			&cli.DurationFlag{
 				Name:  "timeout",
@@ -120,50 +241,448 @@ func NewESPollCmd(commands *Commands) *cli.Command {
 				Value: 1,
 				Usage: "When specified and > 10, this should cause the size parameter to be set.",
 			},
+			&cli.IntFlag{
+				Name:  "expect-count",
+				Usage: "Expect exactly this many matching documents. Unless --min-hits is set, waits for this many documents.",
+			},
+			&cli.IntFlag{
+				Name:  "max-hits",
+				Usage: "Expect at most this many matching documents.",
+			},
+			&cli.StringSliceFlag{
+				Name:  "expect",
+				Usage: "Expect every matching document to have a field with the given value, specified as field=value. May be repeated.",
+			},
+			&cli.BoolFlag{
+				Name:  "expect-absent",
+				Usage: "Expect no documents to match the query, waiting up to --timeout for any matching documents to be removed.",
+			},
+			&cli.BoolFlag{
+				Name:  "quiet",
+				Usage: "Do not print the query or results. Errors are still printed, and the exit code reports the outcome.",
+			},
+			&cli.BoolFlag{
+				Name:  "diagnose",
+				Usage: "On timeout, report whether the target indices exist and how many documents the query matches.",
+			},
+			&cli.StringFlag{
+				Name:  "esql",
+				Usage: "An ES|QL query to run instead of a Query DSL search. --min-hits, --expect-count and --max-hits apply to the number of rows returned.",
+			},
+			&cli.StringSliceFlag{
+				Name:  "param",
+				Usage: "A positional parameter for the ES|QL query. Values are parsed as JSON if possible, and otherwise treated as strings. May be repeated.",
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Value: "result",
+				Usage: "Set the output format to one of: result (the whole search result), hits (a JSON array of hits), sources (each hit's _source as a JSON line), fields (each hit's fields as a JSON line), ndjson (each hit as a JSON line), table.",
+			},
+			&cli.StringSliceFlag{
+				Name:  "fields",
+				Usage: "Comma-separated list of fields to output. Selects the table columns, and restricts the fields of each hit in other formats. Only these fields are fetched from Elasticsearch, without _source.",
+			},
+			&cli.StringFlag{
+				Name:  "extract",
+				Usage: "A gjson path to evaluate against each hit, e.g. _source.trace.id or fields.service\\.name.0, printing each result on its own line.",
+			},
+			&cli.BoolFlag{
+				Name:  "watch",
+				Usage: "Repeatedly run the query, printing documents not printed before, until interrupted or --max-count documents have been printed.",
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Value: time.Second,
+				Usage: "The interval at which to run the query with --watch.",
+			},
+			&cli.DurationFlag{
+				Name:  "lookback",
+				Value: 5 * time.Minute,
+				Usage: "How far behind the newest @timestamp to look for documents indexed late with --watch, such as a trace's root transaction.",
+			},
+			&cli.UintFlag{
+				Name:  "max-count",
+				Usage: "Stop watching after printing this many documents. Zero means no limit.",
+			},
+			&cli.BoolFlag{
+				Name:  "stream",
+				Usage: "Print each matching document as a JSON line as it is fetched, rather than a single search result. Suitable for large result sets.",
+			},
 		},
 	}
 }
 
-func Main(ctx context.Context, cfg config) error {
+func Main(ctx context.Context, esClient *espoll.Client, cfg config) error {
 	if cfg.query == "" {
 		return errors.New("query cannot be empty")
 	}
+	query := stringMarshaler(cfg.query)
 
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: cfg.tlsSkipVerify}
+	opts := []espoll.RequestOption{espoll.WithTimeout(cfg.timeout)}
+	if cfg.diagnose {
+		opts = append(opts, espoll.WithDiagnostics())
+	}
+	if cfg.expect.absent {
+		_, err := esClient.WaitIndexNoDocs(ctx, cfg.target, query, opts...)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return &assertionError{fmt.Sprintf("expected no matching documents: %s", err)}
+		}
+		return err
+	}
+	out := io.Discard
+	if !cfg.quiet {
+		out = os.Stdout
+	}
+	w, err := newHitWriter(out, cfg.format, cfg.fields, cfg.extract, cfg.stream || cfg.watch)
+	if err != nil {
+		return err
+	}
+	if cfg.watch {
+		return watch(ctx, esClient, cfg, w)
+	}
+	req := newSearchRequest(esClient, cfg, query)
+	if cfg.stream {
+		var total int
+		if err := req.IterateMinDocs(ctx,
+			int(cfg.hits),
+			func(hit espoll.SearchHit) error {
+				total++
+				if err := cfg.expect.checkHit(hit); err != nil {
+					return err
+				}
+				return w.write(hit)
+			},
+			opts...,
+		); err != nil {
+			return fmt.Errorf("search request returned error: %w", err)
+		}
+		if err := w.flush(); err != nil {
+			return err
+		}
+		return cfg.expect.checkTotal(total)
+	}
+	result, err := req.SearchMinDocs(ctx, int(cfg.hits), opts...)
+	if err != nil {
+		return fmt.Errorf("search request returned error: %w", err)
+	}
 
-	client, err := elasticsearch.NewClient(elasticsearch.Config{
-		Username:   cfg.esUsername,
-		Password:   cfg.esPassword,
-		Addresses:  strings.Split(cfg.esURL, ","),
-		Transport:  transport,
-		MaxRetries: 5,
-		RetryBackoff: func(attempt int) time.Duration {
-			backoff := (500 * time.Millisecond) * (1 << (attempt - 1))
-			if backoff > maxElasticsearchBackoff {
-				backoff = maxElasticsearchBackoff
+	if cfg.format == "result" && cfg.extract == "" && len(cfg.fields) == 0 {
+		if err := json.NewEncoder(out).Encode(result); err != nil {
+			return fmt.Errorf("failed to encode search result: %w", err)
+		}
+	} else {
+		for _, hit := range result.Hits.Hits {
+			if err := w.write(hit); err != nil {
+				return err
 			}
-			return backoff
-		},
-	})
+		}
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	if err := cfg.expect.checkTotal(result.Hits.Total.Value); err != nil {
+		return err
+	}
+	for _, hit := range result.Hits.Hits {
+		if err := cfg.expect.checkHit(hit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newSearchRequest returns the search request for documents in
+// cfg.target matching query, requesting only searchFields(cfg)
+// without _source if cfg.fields is set.
+func newSearchRequest(esClient *espoll.Client, cfg config, query json.Marshaler) *espoll.SearchRequest {
+	req := esClient.NewSearchRequest(cfg.target).WithQuery(query)
+	req.ExpandWildcards = "open,hidden"
+	if fields := searchFields(cfg); fields != nil {
+		req = req.WithFields(fields...).WithSource(false)
+	}
+	return req
+}
+
+// searchFields returns the fields to request for cfg: the fields in
+// cfg.fields and any with expected values, excluding the metadata
+// fields _index and _id. It returns nil if cfg.fields is empty,
+// meaning all fields and _source should be requested.
+func searchFields(cfg config) []string {
+	if len(cfg.fields) == 0 {
+		return nil
+	}
+	fields := []string{}
+	for _, field := range cfg.fields {
+		// Metadata fields are returned for each hit regardless.
+		if field != "_index" && field != "_id" {
+			fields = append(fields, field)
+		}
+	}
+	for _, expect := range cfg.expect.fields {
+		if !slices.Contains(fields, expect.field) {
+			fields = append(fields, expect.field)
+		}
+	}
+	return fields
+}
+
+func (cmd *Commands) pollESQL(ctx context.Context, c *cli.Command, query string, expect expectations) error {
+	if len(expect.fields) > 0 || expect.absent {
+		return errors.New("--expect and --expect-absent cannot be used with --esql")
+	}
+	params := make([]any, len(c.StringSlice("param")))
+	for i, param := range c.StringSlice("param") {
+		if err := json.Unmarshal([]byte(param), &params[i]); err != nil {
+			params[i] = param
+		}
+	}
+	quiet := c.Bool("quiet")
+	if !quiet {
+		log.Println("esql:", query)
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
+	defer cancel()
+
+	esClient, err := cmd.getESPollClient()
 	if err != nil {
 		return err
 	}
-	esClient := espoll.WrapClient(client)
-	result, err := esClient.SearchIndexMinDocs(ctx,
-		int(cfg.hits), cfg.target, stringMarshaler(cfg.query),
-		espoll.WithTimeout(cfg.timeout),
+	minRows := int(c.Uint("min-hits"))
+	if expect.count != nil && !c.IsSet("min-hits") {
+		minRows = *expect.count
+	}
+	result, err := esClient.ESQLMinRows(ctx,
+		minRows, query, params,
+		espoll.WithTimeout(c.Duration("timeout")),
 	)
 	if err != nil {
-		return fmt.Errorf("search request returned error: %w", err)
+		return fmt.Errorf("ES|QL request returned error: %w", err)
+	}
+	if err := expect.checkTotal(len(result.Values)); err != nil {
+		return err
+	}
+	if quiet {
+		return nil
 	}
 
-	if err := json.NewEncoder(os.Stdout).Encode(result); err != nil {
-		return fmt.Errorf("failed to encode search result: %w", err)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for i, column := range result.Columns {
+		if i > 0 {
+			fmt.Fprint(tw, "\t")
+		}
+		fmt.Fprint(tw, column.Name)
 	}
-	return nil
+	fmt.Fprintln(tw)
+	for _, row := range result.Values {
+		for i, value := range row {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			switch value := value.(type) {
+			case nil:
+			case float64:
+				fmt.Fprint(tw, strconv.FormatFloat(value, 'f', -1, 64))
+			default:
+				fmt.Fprint(tw, value)
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// readStdinQuery reads the query from stdin, used when no
+// query is specified with flags.
+func readStdinQuery(stdin *os.File) (string, error) {
+	stat, err := stdin.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat stdin: %w", err)
+	}
+	if stat.Size() == 0 {
+		return "", errors.New("empty -query flag and stdin, please set one")
+	}
+	b, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read stdin: %w", err)
+	}
+	return strings.Trim(string(b), "\n"), nil
 }
 
 type stringMarshaler string
 
 func (s stringMarshaler) MarshalJSON() ([]byte, error) { return []byte(s), nil }
+
+// watchPageSize is the number of documents fetched
+// per page of search results in watch mode.
+const watchPageSize = 1000
+
+// errMaxCount is returned by the watch callback to
+// stop watching once cfg.maxCount documents are written.
+var errMaxCount = errors.New("max count reached")
+
+// watch repeatedly searches for documents matching cfg.query, writing
+// those not written before to w, until ctx is cancelled or cfg.maxCount
+// documents have been written.
+func watch(ctx context.Context, es *espoll.Client, cfg config, w hitWriter) error {
+	t := tailer{
+		es:       es,
+		target:   cfg.target,
+		query:    stringMarshaler(cfg.query),
+		fields:   searchFields(cfg),
+		size:     watchPageSize,
+		lookback: cfg.watchLookback,
+	}
+	ticker := time.NewTicker(cfg.watchInterval)
+	defer ticker.Stop()
+	var count uint64
+	for {
+		err := t.next(ctx, func(hit espoll.SearchHit) error {
+			if err := w.write(hit); err != nil {
+				return err
+			}
+			if count++; cfg.maxCount > 0 && count >= cfg.maxCount {
+				return errMaxCount
+			}
+			return nil
+		})
+		switch {
+		case errors.Is(err, errMaxCount):
+			return w.flush()
+		case err != nil && ctx.Err() != nil:
+			return nil
+		case err != nil:
+			return fmt.Errorf("search request returned error: %w", err)
+		}
+		if err := w.flush(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// expectations holds the assertions made by the espoll
+// command about the documents matching its query.
+type expectations struct {
+	count   *int
+	maxHits *int
+	fields  []fieldExpectation
+	absent  bool
+}
+
+// fieldExpectation expects a field to have a value.
+type fieldExpectation struct {
+	field string
+	value string
+}
+
+func newExpectations(c *cli.Command) (expectations, error) {
+	var e expectations
+	if c.IsSet("expect-count") {
+		count := int(c.Int("expect-count"))
+		e.count = &count
+	}
+	if c.IsSet("max-hits") {
+		maxHits := int(c.Int("max-hits"))
+		e.maxHits = &maxHits
+	}
+	for _, expect := range c.StringSlice("expect") {
+		field, value, ok := strings.Cut(expect, "=")
+		if !ok || field == "" {
+			return e, fmt.Errorf("invalid --expect %q, expected field=value", expect)
+		}
+		e.fields = append(e.fields, fieldExpectation{field: field, value: value})
+	}
+	e.absent = c.Bool("expect-absent")
+	if e.absent && (e.count != nil || e.maxHits != nil || len(e.fields) > 0) {
+		return e, errors.New("--expect-absent cannot be combined with other expectations")
+	}
+	return e, nil
+}
+
+// any reports whether any expectations have been set.
+func (e expectations) any() bool {
+	return e.count != nil || e.maxHits != nil || len(e.fields) > 0 || e.absent
+}
+
+// checkTotal checks the total number of matching documents.
+func (e expectations) checkTotal(total int) error {
+	if e.count != nil && total != *e.count {
+		return &assertionError{fmt.Sprintf("expected %d matching documents, found %d", *e.count, total)}
+	}
+	if e.maxHits != nil && total > *e.maxHits {
+		return &assertionError{fmt.Sprintf("expected at most %d matching documents, found %d", *e.maxHits, total)}
+	}
+	return nil
+}
+
+// checkHit checks that hit has all of the expected field values.
+func (e expectations) checkHit(hit espoll.SearchHit) error {
+	if len(e.fields) == 0 {
+		return nil
+	}
+	fields, err := hit.DocumentFields()
+	if err != nil {
+		return err
+	}
+	for _, expect := range e.fields {
+		values := fields[expect.field]
+		if !slices.ContainsFunc(values, func(v any) bool {
+			return formatFieldValue(v) == expect.value
+		}) {
+			return &assertionError{fmt.Sprintf(
+				"document %s/%s: expected %s=%s, found %v",
+				hit.Index, hit.ID, expect.field, expect.value, values,
+			)}
+		}
+	}
+	return nil
+}
+
+// formatFieldValue formats a field value for comparison
+// with the value of a field expectation.
+func formatFieldValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// assertionError is returned when an expectation is not met.
+type assertionError struct {
+	msg string
+}
+
+func (e *assertionError) Error() string {
+	return e.msg
+}
+
+// exitError returns err as a cli.ExitCoder, with an exit code
+// describing whether the error was caused by a timeout, an
+// unmet expectation, or failing to connect to Elasticsearch.
+func exitError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var assertionErr *assertionError
+	var netErr net.Error
+	var esErr *espoll.Error
+	code := exitCodeError
+	switch {
+	case errors.As(err, &assertionErr):
+		code = exitCodeAssertion
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, espoll.ErrMaxAttempts):
+		code = exitCodeTimeout
+	case errors.As(err, &esErr):
+	case errors.As(err, &netErr), errors.Is(err, syscall.ECONNREFUSED):
+		code = exitCodeConnection
+	}
+	return cli.Exit(fmt.Sprintf("ERROR: %s", err), code)
+}
@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+func TestReadStdinQuery(t *testing.T) {
+	open := func(t *testing.T, content string) *os.File {
+		path := filepath.Join(t.TempDir(), "stdin")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+
+	query, err := readStdinQuery(open(t, `{"match_all":{}}`+"\n"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"match_all":{}}`, query)
+
+	_, err = readStdinQuery(open(t, ""))
+	assert.EqualError(t, err, "empty -query flag and stdin, please set one")
+}
+
+func TestSearchRequestQueryUnchanged(t *testing.T) {
+	// The --query is sent verbatim, including options
+	// that espoll.BoolQuery cannot represent.
+	const query = `{"bool":{"_name":"q","adjust_pure_negative":true,"filter":[{"term":{"service.name":{"value":"svc","_name":"svc"}}}]}}`
+	req := newSearchRequest(espoll.New(nil), config{target: "traces-*"}, stringMarshaler(query))
+	data, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, query, gjson.GetBytes(data, "query").Raw)
+}
+
+func TestNewSearchRequest(t *testing.T) {
+	body := func(t *testing.T, cfg config) map[string]any {
+		req := newSearchRequest(espoll.New(nil), cfg, stringMarshaler(`{"match_all":{}}`))
+		assert.Equal(t, []string{"traces-*", "logs-*"}, req.Index)
+		assert.Equal(t, "open,hidden", req.ExpandWildcards)
+		data, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(data, &body))
+		return body
+	}
+
+	assert.Equal(t, map[string]any{
+		"query":  map[string]any{"match_all": map[string]any{}},
+		"fields": []any{"*"},
+	}, body(t, config{target: "traces-*,logs-*"}))
+
+	// Only the requested fields, and those with expected
+	// values, are fetched from Elasticsearch.
+	assert.Equal(t, map[string]any{
+		"query":   map[string]any{"match_all": map[string]any{}},
+		"fields":  []any{"service.name", "trace.id"},
+		"_source": false,
+	}, body(t, config{
+		target: "traces-*,logs-*",
+		fields: []string{"_index", "_id", "service.name"},
+		expect: expectations{fields: []fieldExpectation{
+			{field: "service.name", value: "svc"},
+			{field: "trace.id", value: "abc"},
+		}},
+	}))
+
+	assert.Equal(t, map[string]any{
+		"query":   map[string]any{"match_all": map[string]any{}},
+		"_source": false,
+	}, body(t, config{target: "traces-*,logs-*", fields: []string{"_index", "_id"}}))
+}
@@ -0,0 +1,130 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+// maxReportedIndexErrors is the maximum number of
+// bulk item errors printed by index-fixtures.
+const maxReportedIndexErrors = 10
+
+func (cmd *Commands) indexFixturesCommand(ctx context.Context, c *cli.Command) error {
+	var docs []map[string]any
+	files := c.Args().Slice()
+	if len(files) == 0 {
+		stat, err := os.Stdin.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to stat stdin: %w", err)
+		}
+		if stat.Size() == 0 && stat.Mode()&os.ModeCharDevice != 0 {
+			return errors.New("no fixture files specified, and stdin is empty")
+		}
+		if docs, err = espoll.ReadDocs(os.Stdin); err != nil {
+			return fmt.Errorf("error reading stdin: %w", err)
+		}
+	}
+	for _, file := range files {
+		fileDocs, err := readFixtureFile(file)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, fileDocs...)
+	}
+	if len(docs) == 0 {
+		return errors.New("no documents to index")
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
+	defer cancel()
+
+	esClient, err := cmd.getESPollClient()
+	if err != nil {
+		return err
+	}
+	result, err := esClient.IndexDocs(ctx, docs,
+		espoll.WithNamespace(c.String("namespace")),
+		espoll.WithBatchSize(int(c.Uint("batch-size"))),
+		espoll.WithProgress(func(result espoll.BulkIndexResult) {
+			fmt.Fprintf(os.Stderr, "indexed %d/%d documents (%d failed)\n",
+				result.Indexed, result.Total, len(result.Errors),
+			)
+		}),
+	)
+	for i, itemErr := range result.Errors {
+		if i == maxReportedIndexErrors {
+			fmt.Fprintf(os.Stderr, "... %d more errors\n", len(result.Errors)-i)
+			break
+		}
+		fmt.Fprintln(os.Stderr, itemErr)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("indexed %d documents into %s\n", result.Indexed, strings.Join(result.DataStreams, ", "))
+	return nil
+}
+
+func readFixtureFile(name string) ([]map[string]any, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer f.Close()
+	docs, err := espoll.ReadDocs(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", name, err)
+	}
+	return docs, nil
+}
+
+// NewIndexFixturesCmd returns pointer to a Command that indexes APM documents directly into Elasticsearch
+func NewIndexFixturesCmd(commands *Commands) *cli.Command {
+	return &cli.Command{
+		Name:      "index-fixtures",
+		Usage:     "index APM documents directly into Elasticsearch, bypassing APM Server",
+		ArgsUsage: "[file...]",
+		Description: `Index APM documents from approvals files, JSON arrays, or ND-JSON files
+(or stdin) into the APM data streams, by data_stream.* fields or processor.event.
+
+Timestamps are rebased so that the latest document is timestamped now, and
+fields with the approvals placeholder value "dynamic" are removed.`,
+		Action: commands.indexFixturesCommand,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "namespace",
+				Usage: "Data stream namespace to index into, overriding the documents' data_stream.namespace.",
+			},
+			&cli.UintFlag{
+				Name:  "batch-size",
+				Value: 500,
+				Usage: "Maximum number of documents to index in each bulk request.",
+			},
+		},
+	}
+}
@@ -0,0 +1,213 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+// hitFormats holds the output formats supported by hitWriter.
+var hitFormats = []string{"result", "hits", "sources", "fields", "ndjson", "table"}
+
+// defaultTableFields holds the columns printed in table format
+// when no fields are specified.
+var defaultTableFields = []string{"_index", "_id", "@timestamp", "processor.event", "service.name"}
+
+// hitWriter writes search hits in a particular format.
+type hitWriter interface {
+	write(hit espoll.SearchHit) error
+	flush() error
+}
+
+// hitOutput holds the JSON representation of a hit written by hitWriter.
+type hitOutput struct {
+	Index  string           `json:"_index"`
+	ID     string           `json:"_id"`
+	Source json.RawMessage  `json:"_source,omitempty"`
+	Fields map[string][]any `json:"fields,omitempty"`
+}
+
+// newHitWriter returns a hitWriter that writes hits to w.
+//
+// If fields is non-empty, only those fields are written; _source
+// is omitted. If extract is non-empty, it is evaluated as a gjson
+// path against each hit, and the results are written one per line.
+//
+// The "result" format is handled by the caller, as it requires the
+// whole search result; when streaming it is treated as "ndjson".
+// When streaming, "hits" is also treated as "ndjson".
+func newHitWriter(w io.Writer, format string, fields []string, extract string, stream bool) (hitWriter, error) {
+	if extract != "" {
+		return &extractWriter{w: w, fields: fields, path: extract}, nil
+	}
+	switch format {
+	case "result", "ndjson":
+		return &jsonHitWriter{enc: json.NewEncoder(w), fields: fields}, nil
+	case "hits":
+		if stream {
+			return &jsonHitWriter{enc: json.NewEncoder(w), fields: fields}, nil
+		}
+		return &jsonHitWriter{enc: json.NewEncoder(w), fields: fields, array: true}, nil
+	case "sources":
+		if len(fields) > 0 {
+			return nil, errors.New("--fields cannot be used with --format=sources")
+		}
+		return &jsonHitWriter{enc: json.NewEncoder(w), sources: true}, nil
+	case "fields":
+		return &jsonHitWriter{enc: json.NewEncoder(w), fields: fields, onlyFields: true}, nil
+	case "table":
+		if len(fields) == 0 {
+			fields = defaultTableFields
+		}
+		return newTableHitWriter(w, fields), nil
+	}
+	return nil, fmt.Errorf("unknown format %q, expected one of: %s", format, strings.Join(hitFormats, ", "))
+}
+
+// newHitOutput returns the hitOutput for hit, restricted to fields
+// if non-empty.
+func newHitOutput(hit espoll.SearchHit, fields []string) hitOutput {
+	out := hitOutput{Index: hit.Index, ID: hit.ID, Source: hit.RawSource, Fields: hit.Fields}
+	if len(fields) > 0 {
+		out.Source = nil
+		out.Fields = make(map[string][]any, len(fields))
+		for _, field := range fields {
+			if values, ok := hit.Fields[field]; ok {
+				out.Fields[field] = values
+			}
+		}
+	}
+	return out
+}
+
+// jsonHitWriter writes hits, or their sources or fields, as
+// JSON lines or as a single JSON array.
+type jsonHitWriter struct {
+	enc        *json.Encoder
+	fields     []string
+	sources    bool
+	onlyFields bool
+
+	array bool
+	hits  []hitOutput
+}
+
+func (w *jsonHitWriter) write(hit espoll.SearchHit) error {
+	out := newHitOutput(hit, w.fields)
+	switch {
+	case w.array:
+		w.hits = append(w.hits, out)
+		return nil
+	case w.sources:
+		return w.enc.Encode(out.Source)
+	case w.onlyFields:
+		return w.enc.Encode(out.Fields)
+	}
+	return w.enc.Encode(out)
+}
+
+func (w *jsonHitWriter) flush() error {
+	if !w.array {
+		return nil
+	}
+	if w.hits == nil {
+		w.hits = []hitOutput{}
+	}
+	return w.enc.Encode(w.hits)
+}
+
+// tableHitWriter writes hits as a table with a column for each field.
+type tableHitWriter struct {
+	tw     *tabwriter.Writer
+	fields []string
+}
+
+func newTableHitWriter(w io.Writer, fields []string) *tableHitWriter {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(fields, "\t"))
+	return &tableHitWriter{tw: tw, fields: fields}
+}
+
+func (w *tableHitWriter) write(hit espoll.SearchHit) error {
+	fields, err := hit.DocumentFields()
+	if err != nil {
+		return err
+	}
+	for i, field := range w.fields {
+		if i > 0 {
+			fmt.Fprint(w.tw, "\t")
+		}
+		switch field {
+		case "_index":
+			fmt.Fprint(w.tw, hit.Index)
+		case "_id":
+			fmt.Fprint(w.tw, hit.ID)
+		default:
+			values := make([]string, len(fields[field]))
+			for i, v := range fields[field] {
+				values[i] = formatFieldValue(v)
+			}
+			fmt.Fprint(w.tw, strings.Join(values, ","))
+		}
+	}
+	_, err = fmt.Fprintln(w.tw)
+	return err
+}
+
+func (w *tableHitWriter) flush() error {
+	return w.tw.Flush()
+}
+
+// extractWriter writes the result of evaluating a gjson path
+// against each hit's JSON representation, one per line.
+// Strings are written without quotes.
+type extractWriter struct {
+	w      io.Writer
+	fields []string
+	path   string
+}
+
+func (w *extractWriter) write(hit espoll.SearchHit) error {
+	data, err := json.Marshal(newHitOutput(hit, w.fields))
+	if err != nil {
+		return err
+	}
+	result := gjson.GetBytes(data, w.path)
+	if !result.Exists() {
+		return nil
+	}
+	line := result.Raw
+	if result.Type == gjson.String {
+		line = result.Str
+	}
+	_, err = fmt.Fprintln(w.w, line)
+	return err
+}
+
+func (w *extractWriter) flush() error {
+	return nil
+}
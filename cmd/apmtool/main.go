@@ -23,6 +23,8 @@ import (
 	"os"
 
 	"github.com/urfave/cli/v3"
+
+	"github.com/elastic/apm-tools/pkg/apmclient"
 )
 
 func main() {
@@ -72,6 +74,49 @@ func main() {
 				Destination: &commands.cfg.APIKey,
 				Persistent:  true,
 			},
+			&cli.StringFlag{
+				Name:        "bearer-token",
+				Usage:       "set a bearer token for Elasticsearch and Kibana, such as a service account token",
+				Category:    "Elasticsearch",
+				Sources:     cli.EnvVars("ELASTICSEARCH_BEARER_TOKEN", "ELASTICSEARCH_SERVICE_TOKEN"),
+				Destination: &commands.cfg.BearerToken,
+				Persistent:  true,
+			},
+			&cli.StringFlag{
+				Name:        "cloud-id",
+				Usage:       "set the Elastic Cloud ID, from which the Elasticsearch and Kibana URLs will be derived if unspecified",
+				Category:    "Elasticsearch",
+				Sources:     cli.EnvVars("ELASTIC_CLOUD_ID"),
+				Destination: &commands.cfg.CloudID,
+				Persistent:  true,
+				Action: func(ctx context.Context, c *cli.Command, s string) error {
+					return commands.cfg.InferElasticCloudURLs()
+				},
+			},
+			&cli.IntFlag{
+				Name:       "max-retries",
+				Usage:      "set the maximum number of times to retry failed Elasticsearch requests; 0 disables retries",
+				Category:   "Elasticsearch",
+				Value:      apmclient.DefaultMaxRetries,
+				Persistent: true,
+				Action: func(ctx context.Context, c *cli.Command, v int64) error {
+					if v <= 0 {
+						// Config treats zero as DefaultMaxRetries,
+						// and negative values as disabling retries.
+						v = -1
+					}
+					commands.cfg.MaxRetries = int(v)
+					return nil
+				},
+			},
+			&cli.DurationFlag{
+				Name:        "max-retry-backoff",
+				Usage:       "set the maximum time to wait between retries of failed Elasticsearch requests",
+				Category:    "Elasticsearch",
+				Value:       apmclient.DefaultMaxRetryBackoff,
+				Destination: &commands.cfg.MaxRetryBackoff,
+				Persistent:  true,
+			},
 			&cli.StringFlag{
 				Name:        "apm-url",
 				Usage:       "set the APM Server URL. Will be derived from the Elasticsearch URL for Elastic Cloud.",
@@ -81,6 +126,47 @@ func main() {
 				Destination: &commands.cfg.APMServerURL,
 				Persistent:  true,
 			},
+			&cli.StringFlag{
+				Name:        "kibana-url",
+				Usage:       "set the Kibana URL, used for reading APM index settings. Will be derived from the Elasticsearch URL for Elastic Cloud.",
+				Category:    "APM",
+				Value:       "",
+				Sources:     cli.EnvVars("KIBANA_URL"),
+				Destination: &commands.cfg.KibanaURL,
+				Persistent:  true,
+			},
+			&cli.StringFlag{
+				Name:        "transaction-indices",
+				Usage:       "set the index patterns for querying transactions. Defaults to Kibana's APM index settings.",
+				Category:    "APM",
+				Sources:     cli.EnvVars("APM_TRANSACTION_INDICES"),
+				Destination: &commands.cfg.Indices.Transaction,
+				Persistent:  true,
+			},
+			&cli.StringFlag{
+				Name:        "span-indices",
+				Usage:       "set the index patterns for querying spans. Defaults to Kibana's APM index settings.",
+				Category:    "APM",
+				Sources:     cli.EnvVars("APM_SPAN_INDICES"),
+				Destination: &commands.cfg.Indices.Span,
+				Persistent:  true,
+			},
+			&cli.StringFlag{
+				Name:        "error-indices",
+				Usage:       "set the index patterns for querying errors. Defaults to Kibana's APM index settings.",
+				Category:    "APM",
+				Sources:     cli.EnvVars("APM_ERROR_INDICES"),
+				Destination: &commands.cfg.Indices.Error,
+				Persistent:  true,
+			},
+			&cli.StringFlag{
+				Name:        "metric-indices",
+				Usage:       "set the index patterns for querying metrics. Defaults to Kibana's APM index settings.",
+				Category:    "APM",
+				Sources:     cli.EnvVars("APM_METRIC_INDICES"),
+				Destination: &commands.cfg.Indices.Metric,
+				Persistent:  true,
+			},
 			&cli.BoolFlag{
 				Name:        "insecure",
 				Usage:       "skip TLS certificate verification of Elasticsearch and APM server",
@@ -95,8 +181,14 @@ func main() {
 			NewSendEventCmd(commands),
 			NewUploadSourcemapCmd(commands),
 			NewListServiceCmd(commands),
+			NewAgentsCmd(commands),
+			NewTransactionsCmd(commands),
+			NewInstancesCmd(commands),
+			NewTopCmd(commands),
 			NewTraceGenCmd(commands),
 			NewESPollCmd(commands),
+			NewTailCmd(commands),
+			NewIndexFixturesCmd(commands),
 		},
 	}
 	if err := cmd.Run(context.Background(), os.Args); err != nil {
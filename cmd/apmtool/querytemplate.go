@@ -0,0 +1,121 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// builtinQueries holds the named query templates
+// available to espoll with --named-query.
+//
+//go:embed queries/*.json.tmpl
+var builtinQueries embed.FS
+
+const queryTemplateSuffix = ".json.tmpl"
+
+// builtinQueryNames returns the names of the built-in query templates.
+func builtinQueryNames() []string {
+	entries, _ := fs.ReadDir(builtinQueries, "queries")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), queryTemplateSuffix))
+	}
+	slices.Sort(names)
+	return names
+}
+
+// builtinQuery returns the text of the named built-in query template.
+func builtinQuery(name string) (string, error) {
+	data, err := builtinQueries.ReadFile(path.Join("queries", name+queryTemplateSuffix))
+	if err != nil {
+		return "", fmt.Errorf(
+			"unknown query %q, expected one of: %s",
+			name, strings.Join(builtinQueryNames(), ", "),
+		)
+	}
+	return string(data), nil
+}
+
+// renderQuery renders a Query DSL template with vars.
+//
+// Variables are referenced as {{.name}}, and it is an error for
+// them to be missing; optional variables may be referenced with
+// {{get "name" "default"}}. In addition, the following functions
+// are available:
+//
+//   - json: encode a value as JSON, e.g. {{json .service}}
+//   - now: the current time
+//   - ago: the current time minus a duration, e.g. {{ago "15m"}}
+//   - add: add a duration to a time, e.g. {{now | add "-1h"}}
+//   - rfc3339: format a time as RFC 3339
+//   - unixMillis: format a time as milliseconds since the Unix epoch
+//
+// Times are encoded by json in RFC 3339 format.
+func renderQuery(name, text string, vars map[string]string) (string, error) {
+	now := time.Now().UTC()
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"get": func(name, defaultValue string) string {
+			if v, ok := vars[name]; ok {
+				return v
+			}
+			return defaultValue
+		},
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"now": func() time.Time { return now },
+		"ago": func(d string) (time.Time, error) {
+			duration, err := time.ParseDuration(d)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return now.Add(-duration), nil
+		},
+		"add": func(d string, t time.Time) (time.Time, error) {
+			duration, err := time.ParseDuration(d)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return t.Add(duration), nil
+		},
+		"rfc3339":    func(t time.Time) string { return t.Format(time.RFC3339Nano) },
+		"unixMillis": func(t time.Time) int64 { return t.UnixMilli() },
+	}).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("error parsing query template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("error rendering query template: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return "", fmt.Errorf("query template %s rendered invalid JSON:\n%s", name, buf.String())
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,172 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-tools/pkg/apmclient"
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+func TestRenderQuery(t *testing.T) {
+	query, err := renderQuery("test", `{"term": {"service.name": {{json .service}}}}`, map[string]string{
+		"service": `a "quoted" name`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `{"term": {"service.name": "a \"quoted\" name"}}`, query)
+
+	query, err = renderQuery("test", `{"term": {"service.environment": {{json (get "environment" "production")}}}}`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `{"term": {"service.environment": "production"}}`, query)
+
+	before := time.Now().Add(-time.Hour).UnixMilli()
+	query, err = renderQuery("test", `{"range": {"@timestamp": {"gte": {{ago "1h" | unixMillis}}, "lte": {{now | add "1h" | json}}}}}`, nil)
+	require.NoError(t, err)
+	var body struct {
+		Range struct {
+			Timestamp struct {
+				GTE int64     `json:"gte"`
+				LTE time.Time `json:"lte"`
+			} `json:"@timestamp"`
+		} `json:"range"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(query), &body))
+	assert.InDelta(t, before, body.Range.Timestamp.GTE, float64(time.Minute.Milliseconds()))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), body.Range.Timestamp.LTE, time.Minute)
+
+	for name, test := range map[string]struct {
+		text string
+		vars map[string]string
+		err  string
+	}{
+		"missing_var":      {text: `{{json .service}}`, err: `map has no entry for key "service"`},
+		"invalid_duration": {text: `{{ago "soon" | unixMillis}}`, err: `invalid duration "soon"`},
+		"parse_error":      {text: `{{json .service`, err: "error parsing query template"},
+		"invalid_json": {
+			text: `{"term": {{.service}}}`,
+			vars: map[string]string{"service": "svc"},
+			err:  "query template test rendered invalid JSON",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := renderQuery("test", test.text, test.vars)
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+func TestBuiltinQueries(t *testing.T) {
+	assert.Equal(t, []string{"service-errors", "service-metrics", "trace"}, builtinQueryNames())
+
+	_, err := builtinQuery("unknown")
+	assert.EqualError(t, err, `unknown query "unknown", expected one of: service-errors, service-metrics, trace`)
+
+	for _, test := range []struct {
+		name   string
+		vars   map[string]string
+		filter []string
+	}{{
+		name: "trace",
+		vars: map[string]string{"trace_id": "abc"},
+		filter: []string{
+			`{"term": {"trace.id": "abc"}}`,
+		},
+	}, {
+		name: "service-errors",
+		vars: map[string]string{"service": "svc"},
+		filter: []string{
+			`{"term": {"processor.event": "error"}}`,
+			`{"term": {"service.name": "svc"}}`,
+			`{"range": {"@timestamp": {"gte": "now-15m"}}}`,
+		},
+	}, {
+		name: "service-errors",
+		vars: map[string]string{"service": "svc", "environment": "prod", "since": "now-1h"},
+		filter: []string{
+			`{"term": {"processor.event": "error"}}`,
+			`{"term": {"service.name": "svc"}}`,
+			`{"term": {"service.environment": "prod"}}`,
+			`{"range": {"@timestamp": {"gte": "now-1h"}}}`,
+		},
+	}, {
+		name: "service-metrics",
+		vars: map[string]string{"service": "svc", "metricset": "app"},
+		filter: []string{
+			`{"term": {"processor.event": "metric"}}`,
+			`{"term": {"service.name": "svc"}}`,
+			`{"term": {"metricset.name": "app"}}`,
+			`{"range": {"@timestamp": {"gte": "now-15m"}}}`,
+		},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			text, err := builtinQuery(test.name)
+			require.NoError(t, err)
+			query, err := renderQuery(test.name, text, test.vars)
+			require.NoError(t, err)
+
+			var bq espoll.BoolQuery
+			require.NoError(t, json.Unmarshal([]byte(query), &bq))
+			require.Len(t, bq.Filter, len(test.filter))
+			for i, filter := range test.filter {
+				data, err := json.Marshal(bq.Filter[i])
+				require.NoError(t, err)
+				assert.JSONEq(t, filter, string(data))
+			}
+
+			// Required variables must be set.
+			_, err = renderQuery(test.name, text, map[string]string{})
+			assert.ErrorContains(t, err, "map has no entry for key")
+		})
+	}
+}
+
+func TestPollDocsValidatesQueryFirst(t *testing.T) {
+	// Resolving the default target requires a request to Kibana,
+	// which should not be made if the query flags are invalid.
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	commands := &Commands{cfg: apmclient.Config{ElasticsearchURL: srv.URL, KibanaURL: srv.URL}}
+	for _, args := range [][]string{
+		{"--query", `{"match_all":{}}`, "--kql", "service.name:svc"},
+		{"--kql", "service.name:svc", "--named-query", "trace"},
+		{"--named-query", "unknown"},
+		{"--named-query", "trace"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			err := NewESPollCmd(commands).Run(context.Background(), append([]string{"espoll"}, args...))
+			assert.Error(t, err)
+		})
+	}
+	assert.Zero(t, requests.Load())
+}
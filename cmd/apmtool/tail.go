@@ -0,0 +1,319 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+func (cmd *Commands) tailCommand(ctx context.Context, c *cli.Command) error {
+	target := c.String("target")
+	if target == "" {
+		indices, err := cmd.getIndices(ctx)
+		if err != nil {
+			return err
+		}
+		target = indices.All()
+	}
+	esClient, err := cmd.getESPollClient()
+	if err != nil {
+		return err
+	}
+
+	var filter []any
+	if service := c.String("service"); service != "" {
+		filter = append(filter, espoll.TermQuery{Field: "service.name", Value: service})
+	}
+	if event := c.String("event"); event != "" {
+		filter = append(filter, espoll.TermQuery{Field: "processor.event", Value: event})
+	}
+	if traceID := c.String("trace-id"); traceID != "" {
+		filter = append(filter, espoll.TermQuery{Field: "trace.id", Value: traceID})
+	}
+	if query := c.String("query"); query != "" {
+		filter = append(filter, stringMarshaler(query))
+	}
+
+	if c.Uint("batch-size") == 0 {
+		return fmt.Errorf("batch-size must be greater than zero")
+	}
+	format := c.String("format")
+	if format != "compact" && format != "json" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
+	defer cancel()
+
+	t := tailer{
+		es:       esClient,
+		target:   target,
+		query:    espoll.BoolQuery{Filter: filter},
+		size:     int(c.Uint("batch-size")),
+		since:    time.Now().Add(-c.Duration("since")),
+		lookback: c.Duration("lookback"),
+	}
+	ticker := time.NewTicker(c.Duration("interval"))
+	defer ticker.Stop()
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		if err := t.next(ctx, func(hit espoll.SearchHit) error {
+			if format == "json" {
+				return enc.Encode(hit.Source)
+			}
+			_, err := fmt.Println(summarizeHit(hit))
+			return err
+		}); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// tailer searches for documents in order of @timestamp, returning
+// only those which have not been returned before, as identified by
+// their _index and _id.
+//
+// Each call to next opens a point in time and pages through all
+// matching documents using search_after, sorted by @timestamp and
+// _shard_doc. Documents with a @timestamp older than lookback behind
+// the newest returned so far are not searched again, and are then
+// forgotten; this bounds the memory used, while still returning
+// documents indexed after newer ones, such as a trace's root
+// transaction indexed after its spans. Documents without a @timestamp
+// are always searched, and remembered indefinitely.
+type tailer struct {
+	es     *espoll.Client
+	target string
+	query  json.Marshaler
+	size   int
+
+	// fields, if non-nil, restricts the fields requested for each
+	// document, in addition to @timestamp, and disables _source.
+	fields []string
+
+	// since, if non-zero, excludes documents with an older @timestamp.
+	since time.Time
+
+	// lookback is how far behind the newest @timestamp
+	// documents are searched for, and remembered.
+	lookback time.Duration
+
+	newest time.Time
+	seen   map[string]time.Time
+}
+
+// next calls fn for each new document in order of @timestamp,
+// until there are no more or fn returns an error.
+func (t *tailer) next(ctx context.Context, fn func(espoll.SearchHit) error) error {
+	var filter []any
+	if from := t.from(); !from.IsZero() {
+		filter = append(filter, espoll.BoolQuery{
+			Should: []any{
+				stringMarshaler(fmt.Sprintf(
+					`{"range":{"@timestamp":{"gte":%q,"format":"strict_date_optional_time_nanos"}}}`,
+					from.UTC().Format(time.RFC3339Nano),
+				)),
+				espoll.BoolQuery{MustNot: []any{espoll.ExistsQuery{Field: "@timestamp"}}},
+			},
+			MinimumShouldMatch: 1,
+		})
+	}
+	if t.query != nil {
+		filter = append(filter, t.query)
+	}
+	req := t.es.NewSearchRequest(t.target).
+		WithQuery(espoll.BoolQuery{Filter: filter}).
+		WithSort("@timestamp:asc", "_shard_doc").
+		WithSize(t.size)
+	req.ExpandWildcards = "open,hidden"
+	if t.fields != nil {
+		req = req.WithFields(append(slices.Clip(t.fields), "@timestamp")...).WithSource(false)
+	}
+
+	err := req.Iterate(ctx, func(hit espoll.SearchHit) error {
+		key := hit.Index + "/" + hit.ID
+		if _, ok := t.seen[key]; ok {
+			return nil
+		}
+		timestamp, err := hitTimestamp(hit)
+		if err != nil {
+			return err
+		}
+		if t.seen == nil {
+			t.seen = make(map[string]time.Time)
+		}
+		t.seen[key] = timestamp
+		if timestamp.After(t.newest) {
+			t.newest = timestamp
+		}
+		return fn(hit)
+	})
+	t.forget()
+	return err
+}
+
+// from returns the oldest @timestamp to search for,
+// or the zero time if there is no lower bound.
+func (t *tailer) from() time.Time {
+	from := t.since
+	if !t.newest.IsZero() {
+		if cutoff := t.newest.Add(-t.lookback); cutoff.After(from) {
+			from = cutoff
+		}
+	}
+	return from
+}
+
+// forget removes documents which will no longer be
+// searched for from the set of those returned.
+func (t *tailer) forget() {
+	from := t.from()
+	for key, timestamp := range t.seen {
+		if !timestamp.IsZero() && timestamp.Before(from) {
+			delete(t.seen, key)
+		}
+	}
+}
+
+// hitTimestamp returns the @timestamp of hit,
+// or the zero time if it has none.
+func hitTimestamp(hit espoll.SearchHit) (time.Time, error) {
+	s, _ := hitField(hit, "@timestamp").(string)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error parsing @timestamp of %s/%s: %w", hit.Index, hit.ID, err)
+	}
+	return timestamp, nil
+}
+
+// hitField returns the first value of the named field in hit.Fields, or nil.
+func hitField(hit espoll.SearchHit, name string) any {
+	if values := hit.Fields[name]; len(values) > 0 {
+		return values[0]
+	}
+	return nil
+}
+
+// summarizeHit returns a one-line summary of an APM document.
+func summarizeHit(hit espoll.SearchHit) string {
+	event, _ := hitField(hit, "processor.event").(string)
+	var name any
+	switch event {
+	case "transaction":
+		name = hitField(hit, "transaction.name")
+	case "span":
+		name = hitField(hit, "span.name")
+	case "error":
+		if name = hitField(hit, "error.exception.message"); name == nil {
+			name = hitField(hit, "error.log.message")
+		}
+	case "metric":
+		name = hitField(hit, "metricset.name")
+	default:
+		name = hitField(hit, "message")
+	}
+	parts := []string{
+		fmt.Sprint(hitField(hit, "@timestamp")),
+		event,
+		fmt.Sprint(hitField(hit, "service.name")),
+	}
+	if name != nil {
+		parts = append(parts, fmt.Sprintf("%q", name))
+	}
+	if traceID := hitField(hit, "trace.id"); traceID != nil {
+		parts = append(parts, fmt.Sprintf("trace.id=%v", traceID))
+	}
+	return strings.Join(parts, " ")
+}
+
+// NewTailCmd returns pointer to a Command that streams newly ingested APM documents
+func NewTailCmd(commands *Commands) *cli.Command {
+	return &cli.Command{
+		Name:   "tail",
+		Usage:  "continuously print newly ingested APM documents",
+		Action: commands.tailCommand,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "target",
+				Usage: "Comma-separated list of data streams, indices, and aliases to search (Supports wildcards (*)). Defaults to all APM indices.",
+			},
+			&cli.StringFlag{
+				Name:  "service",
+				Usage: "only print documents with this service.name",
+			},
+			&cli.StringFlag{
+				Name:  "event",
+				Usage: "only print documents with this processor.event, e.g. transaction, span, error, metric",
+			},
+			&cli.StringFlag{
+				Name:  "trace-id",
+				Usage: "only print documents with this trace.id",
+			},
+			&cli.StringFlag{
+				Name:  "query",
+				Usage: "only print documents matching this Elasticsearch query in Query DSL",
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "set the output format to one of: compact, json",
+				Value: "compact",
+			},
+			&cli.DurationFlag{
+				Name:  "since",
+				Usage: "also print documents with a @timestamp within this duration before starting",
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Usage: "how often to poll for new documents",
+				Value: time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "lookback",
+				Usage: "how far behind the newest @timestamp to look for documents indexed late",
+				Value: 30 * time.Second,
+			},
+			&cli.UintFlag{
+				Name:  "batch-size",
+				Usage: "number of documents to fetch per page of search results",
+				Value: 100,
+			},
+		},
+	}
+}
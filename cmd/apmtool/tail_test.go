@@ -0,0 +1,309 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+type transportFunc func(*http.Request) (*http.Response, error)
+
+func (f transportFunc) Perform(req *http.Request) (*http.Response, error) { return f(req) }
+
+type fakeDoc struct {
+	id        string
+	timestamp time.Time
+}
+
+// fakeTailIndex emulates an Elasticsearch index for tailer, supporting
+// point in time searches filtered by a @timestamp range, sorted by
+// @timestamp and _shard_doc, and paginated with search_after.
+// Documents without a @timestamp sort last, and always match.
+type fakeTailIndex struct {
+	docs     []fakeDoc
+	searches int
+	openPITs int
+
+	// lastBody holds the body of the last search request.
+	lastBody gjson.Result
+}
+
+func (f *fakeTailIndex) client() *espoll.Client {
+	return espoll.New(transportFunc(func(req *http.Request) (*http.Response, error) {
+		status, body := f.handle(req)
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	}))
+}
+
+func (f *fakeTailIndex) handle(req *http.Request) (int, string) {
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/_pit") && req.Method == http.MethodPost:
+		f.openPITs++
+		return http.StatusOK, `{"id":"pit"}`
+	case req.URL.Path == "/_pit" && req.Method == http.MethodDelete:
+		f.openPITs--
+		return http.StatusOK, `{"succeeded":true}`
+	case req.URL.Path == "/_search":
+	default:
+		return http.StatusBadRequest, `{"error":"unexpected request"}`
+	}
+	f.searches++
+	body, _ := io.ReadAll(req.Body)
+	query := gjson.ParseBytes(body)
+	f.lastBody = query
+	var gte time.Time
+	if v := query.Get(`query.bool.filter.0.bool.should.0.range.@timestamp.gte`); v.Exists() {
+		var err error
+		if gte, err = time.Parse(time.RFC3339Nano, v.String()); err != nil {
+			return http.StatusBadRequest, fmt.Sprintf(`{"error":%q}`, err)
+		}
+	}
+	size := int(query.Get("size").Int())
+	after := query.Get("search_after").Array()
+
+	// Each document's position serves as its _shard_doc.
+	type sortValues struct{ ms, pos int64 }
+	sortOf := func(i int) sortValues {
+		if f.docs[i].timestamp.IsZero() {
+			return sortValues{math.MaxInt64, int64(i)}
+		}
+		return sortValues{f.docs[i].timestamp.UnixMilli(), int64(i)}
+	}
+	less := func(a, b sortValues) bool {
+		return a.ms < b.ms || (a.ms == b.ms && a.pos < b.pos)
+	}
+	var matches []int
+	for i, doc := range f.docs {
+		if !doc.timestamp.IsZero() && doc.timestamp.Before(gte) {
+			continue
+		}
+		if len(after) == 2 && !less(sortValues{after[0].Int(), after[1].Int()}, sortOf(i)) {
+			continue
+		}
+		matches = append(matches, i)
+	}
+	slices.SortFunc(matches, func(a, b int) int {
+		if less(sortOf(a), sortOf(b)) {
+			return -1
+		}
+		return 1
+	})
+	hits := []map[string]any{}
+	for _, i := range matches[:min(size, len(matches))] {
+		fields := map[string]any{}
+		if !f.docs[i].timestamp.IsZero() {
+			fields["@timestamp"] = []string{f.docs[i].timestamp.Format(time.RFC3339Nano)}
+		}
+		sort := sortOf(i)
+		hits = append(hits, map[string]any{
+			"_index":  "traces-apm-default",
+			"_id":     f.docs[i].id,
+			"_source": map[string]any{},
+			"sort":    []any{sort.ms, sort.pos},
+			"fields":  fields,
+		})
+	}
+	out, _ := json.Marshal(map[string]any{"pit_id": "pit", "hits": map[string]any{"hits": hits}})
+	return http.StatusOK, string(out)
+}
+
+func (f *fakeTailIndex) add(timestamp time.Time, n int) {
+	for i := 0; i < n; i++ {
+		f.docs = append(f.docs, fakeDoc{id: fmt.Sprintf("doc%d", len(f.docs)), timestamp: timestamp})
+	}
+}
+
+// tailIDs returns the IDs of the documents returned by tail.next.
+func tailIDs(t *testing.T, tail *tailer) []string {
+	t.Helper()
+	var ids []string
+	require.NoError(t, tail.next(context.Background(), func(hit espoll.SearchHit) error {
+		ids = append(ids, hit.ID)
+		return nil
+	}))
+	return ids
+}
+
+func TestTailerIdenticalTimestamps(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var index fakeTailIndex
+	index.add(start, 250)
+
+	tail := tailer{es: index.client(), target: "traces-apm*", size: 100, since: start}
+	ids := tailIDs(t, &tail)
+	require.Len(t, ids, 250)
+	assert.Equal(t, "doc0", ids[0])
+	assert.Equal(t, "doc249", ids[249])
+	assert.Equal(t, 3, index.searches)
+	assert.Zero(t, index.openPITs)
+
+	assert.Empty(t, tailIDs(t, &tail))
+
+	index.add(start, 1)
+	index.add(start.Add(time.Millisecond), 2)
+	assert.Equal(t, []string{"doc250", "doc251", "doc252"}, tailIDs(t, &tail))
+	assert.Empty(t, tailIDs(t, &tail))
+}
+
+func TestTailerStop(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var index fakeTailIndex
+	index.add(start, 10)
+
+	tail := tailer{es: index.client(), target: "traces-apm*", size: 4, since: start}
+	errStop := fmt.Errorf("stop")
+	var n int
+	err := tail.next(context.Background(), func(hit espoll.SearchHit) error {
+		if n++; n == 5 {
+			return errStop
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Zero(t, index.openPITs)
+
+	// The document that stopped iteration was consumed.
+	assert.Equal(t, []string{"doc5", "doc6", "doc7", "doc8", "doc9"}, tailIDs(t, &tail))
+}
+
+func TestTailerLateDocuments(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var index fakeTailIndex
+	index.add(start.Add(time.Second), 2) // spans
+
+	tail := tailer{es: index.client(), target: "traces-apm*", size: 10, lookback: time.Minute}
+	assert.Equal(t, []string{"doc0", "doc1"}, tailIDs(t, &tail))
+
+	// The root transaction is indexed after its spans,
+	// with an older @timestamp, and is still returned.
+	index.add(start, 1)
+	assert.Equal(t, []string{"doc2"}, tailIDs(t, &tail))
+
+	// Documents without a @timestamp are returned once.
+	index.add(time.Time{}, 1)
+	assert.Equal(t, []string{"doc3"}, tailIDs(t, &tail))
+	assert.Empty(t, tailIDs(t, &tail))
+}
+
+func TestTailerLookback(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var index fakeTailIndex
+	index.add(start, 2)
+	index.add(start.Add(time.Minute), 1)
+
+	tail := tailer{es: index.client(), target: "traces-apm*", size: 10, lookback: 30 * time.Second}
+	assert.Equal(t, []string{"doc0", "doc1", "doc2"}, tailIDs(t, &tail))
+
+	// Documents older than the lookback are forgotten,
+	// and no longer searched for.
+	assert.Equal(t, map[string]time.Time{"traces-apm-default/doc2": start.Add(time.Minute)}, tail.seen)
+	index.add(start.Add(40*time.Second), 1)
+	index.add(start.Add(20*time.Second), 1)
+	assert.Equal(t, []string{"doc3"}, tailIDs(t, &tail))
+	assert.Equal(t, start.Add(30*time.Second).Format(time.RFC3339Nano),
+		index.lastBody.Get(`query.bool.filter.0.bool.should.0.range.@timestamp.gte`).String(),
+	)
+	assert.Len(t, tail.seen, 2)
+}
+
+// hitRecorder is a hitWriter that records the IDs of hits written.
+type hitRecorder struct {
+	ids     []string
+	flushes int
+	onFlush func()
+}
+
+func (r *hitRecorder) write(hit espoll.SearchHit) error {
+	r.ids = append(r.ids, hit.ID)
+	return nil
+}
+
+func (r *hitRecorder) flush() error {
+	r.flushes++
+	if r.onFlush != nil {
+		r.onFlush()
+	}
+	return nil
+}
+
+func TestWatch(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var index fakeTailIndex
+	// More documents than fit in a page, all with the same @timestamp.
+	index.add(start, watchPageSize+500)
+
+	// After the first search, a document with an older
+	// @timestamp is indexed, as a trace's root transaction is.
+	w := hitRecorder{onFlush: func() { index.add(start.Add(-time.Minute), 1) }}
+	err := watch(context.Background(), index.client(), config{
+		query:         `{"match_all":{}}`,
+		target:        "traces-apm*",
+		watchInterval: time.Millisecond,
+		watchLookback: 5 * time.Minute,
+		maxCount:      watchPageSize + 501,
+		fields:        []string{"_id", "service.name"},
+	}, &w)
+	require.NoError(t, err)
+	require.Len(t, w.ids, watchPageSize+501)
+	for i, id := range w.ids {
+		require.Equal(t, fmt.Sprintf("doc%d", i), id)
+	}
+	assert.Equal(t, 2, w.flushes)
+	assert.Zero(t, index.openPITs)
+	assert.JSONEq(t, `["service.name", "@timestamp"]`, index.lastBody.Get("fields").Raw)
+	assert.Equal(t, "false", index.lastBody.Get("_source").Raw)
+	assert.JSONEq(t, `{"match_all":{}}`, index.lastBody.Get("query.bool.filter.1").Raw)
+}
+
+func TestWatchCancel(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var index fakeTailIndex
+	index.add(start, 3)
+
+	// Watch writes the existing documents and waits
+	// for the next interval, until cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	w := hitRecorder{onFlush: cancel}
+	err := watch(ctx, index.client(), config{
+		query:         `{"match_all":{}}`,
+		target:        "traces-apm*",
+		watchInterval: time.Hour,
+	}, &w)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"doc0", "doc1", "doc2"}, w.ids)
+	assert.Equal(t, 1, w.flushes)
+}
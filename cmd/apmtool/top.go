@@ -0,0 +1,282 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/elastic/apm-tools/pkg/apmclient"
+)
+
+// topSortKeys holds the columns by which rows may be sorted in apmtool top.
+var topSortKeys = []string{"throughput", "latency", "failure", "instances", "name"}
+
+// topState holds the state of the apmtool top terminal dashboard.
+type topState struct {
+	client *apmclient.Client
+	window time.Duration
+
+	// service holds the name of the service being drilled into,
+	// or is empty if all services are being displayed.
+	service string
+	sortKey int
+	reverse bool
+
+	services     []apmclient.ServiceMetrics
+	transactions []apmclient.TransactionGroup
+	dependencies []apmclient.ServiceDependency
+	refreshed    time.Time
+	err          error
+}
+
+func (cmd *Commands) topCommand(ctx context.Context, c *cli.Command) error {
+	client, err := cmd.getClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
+	defer cancel()
+
+	// Commands are read a line at a time, as the terminal is not put
+	// into raw mode. If stdin is closed or not a terminal, the dashboard
+	// keeps refreshing until interrupted.
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			select {
+			case lines <- strings.TrimSpace(scanner.Text()):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Switch to the alternate screen buffer, restoring the
+	// original screen contents on exit.
+	fmt.Print("\x1b[?1049h")
+	defer fmt.Print("\x1b[?1049l")
+
+	state := &topState{client: client, window: c.Duration("window")}
+	ticker := time.NewTicker(c.Duration("interval"))
+	defer ticker.Stop()
+	state.refresh(ctx)
+	for {
+		state.render()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			state.refresh(ctx)
+		case line := <-lines:
+			if quit := state.handle(line); quit {
+				return nil
+			}
+			state.refresh(ctx)
+		}
+	}
+}
+
+// handle handles a command entered by the user,
+// returning true if the dashboard should exit.
+func (s *topState) handle(line string) bool {
+	switch line {
+	case "q":
+		return true
+	case "s":
+		s.sortKey = (s.sortKey + 1) % len(topSortKeys)
+		if s.service != "" && topSortKeys[s.sortKey] == "instances" {
+			// Transactions and dependencies have no instances column.
+			s.sortKey = (s.sortKey + 1) % len(topSortKeys)
+		}
+	case "r":
+		s.reverse = !s.reverse
+	case "b":
+		s.service = ""
+	default:
+		if n, err := strconv.Atoi(line); err == nil && s.service == "" && n > 0 && n <= len(s.services) {
+			s.service = s.services[n-1].Name
+			if topSortKeys[s.sortKey] == "instances" {
+				s.sortKey = 0
+			}
+		}
+	}
+	return false
+}
+
+func (s *topState) refresh(ctx context.Context) {
+	options := []apmclient.Option{apmclient.WithTimeRange(time.Now().Add(-s.window), time.Time{})}
+	s.refreshed = time.Now()
+	if s.service == "" {
+		s.services, s.err = s.client.ServiceMetrics(ctx, options...)
+		return
+	}
+	if s.transactions, s.err = s.client.TransactionGroups(ctx, s.service, options...); s.err != nil {
+		return
+	}
+	s.dependencies, s.err = s.client.ServiceDependencies(ctx, s.service, options...)
+}
+
+func (s *topState) render() {
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H\x1b[2J")
+	title := "services"
+	if s.service != "" {
+		title = "service " + s.service
+	}
+	order := "descending"
+	if s.reverse {
+		order = "ascending"
+	}
+	fmt.Fprintf(&buf, "apmtool top - %s - last %s - refreshed %s - sorted by %s (%s)\n\n",
+		title, s.window, s.refreshed.Format(time.TimeOnly), topSortKeys[s.sortKey], order,
+	)
+	if s.err != nil {
+		fmt.Fprintf(&buf, "ERROR: %s\n\n", s.err)
+	}
+
+	tw := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	if s.service == "" {
+		services := s.services
+		s.sort(len(services), func(i int) topRow {
+			return topRow{services[i].Name, services[i].ThroughputPerMinute, services[i].LatencyP95, services[i].FailureRate, services[i].Instances}
+		}, func(i, j int) { services[i], services[j] = services[j], services[i] })
+		fmt.Fprintln(tw, "#\tSERVICE\tTPM\tP50\tP95\tP99\tFAILURE RATE\tINSTANCES")
+		for i, svc := range services {
+			fmt.Fprintf(tw, "%d\t%s\t%.1f\t%s\t%s\t%s\t%.2f%%\t%d\n", i+1,
+				svc.Name, svc.ThroughputPerMinute,
+				formatLatency(svc.LatencyP50), formatLatency(svc.LatencyP95), formatLatency(svc.LatencyP99),
+				svc.FailureRate*100, svc.Instances,
+			)
+		}
+		tw.Flush()
+		buf.WriteString("\n<n> show service, s sort, r reverse, q quit. Press Enter after each command.\n")
+	} else {
+		transactions := s.transactions
+		s.sort(len(transactions), func(i int) topRow {
+			return topRow{transactions[i].Name, transactions[i].ThroughputPerMinute, transactions[i].LatencyP95, transactions[i].FailureRate, 0}
+		}, func(i, j int) { transactions[i], transactions[j] = transactions[j], transactions[i] })
+		fmt.Fprintln(tw, "TRANSACTION\tTYPE\tTPM\tP50\tP95\tP99\tFAILURE RATE")
+		for _, g := range transactions {
+			fmt.Fprintf(tw, "%s\t%s\t%.1f\t%s\t%s\t%s\t%.2f%%\n",
+				g.Name, g.Type, g.ThroughputPerMinute,
+				formatLatency(g.LatencyP50), formatLatency(g.LatencyP95), formatLatency(g.LatencyP99),
+				g.FailureRate*100,
+			)
+		}
+		tw.Flush()
+		buf.WriteString("\n")
+
+		dependencies := s.dependencies
+		s.sort(len(dependencies), func(i int) topRow {
+			return topRow{dependencies[i].Resource, dependencies[i].ThroughputPerMinute, dependencies[i].LatencyAvg, dependencies[i].FailureRate, 0}
+		}, func(i, j int) { dependencies[i], dependencies[j] = dependencies[j], dependencies[i] })
+		fmt.Fprintln(tw, "DEPENDENCY\tTPM\tAVG LATENCY\tFAILURE RATE")
+		for _, d := range dependencies {
+			fmt.Fprintf(tw, "%s\t%.1f\t%s\t%.2f%%\n",
+				d.Resource, d.ThroughputPerMinute, formatLatency(d.LatencyAvg), d.FailureRate*100,
+			)
+		}
+		tw.Flush()
+		buf.WriteString("\nb back, s sort, r reverse, q quit. Press Enter after each command.\n")
+	}
+	os.Stdout.Write(buf.Bytes())
+}
+
+// topRow holds the sortable columns of a row in apmtool top.
+type topRow struct {
+	name       string
+	throughput float64
+	latency    time.Duration
+	failure    float64
+	instances  int64
+}
+
+func (s *topState) sort(n int, row func(int) topRow, swap func(i, j int)) {
+	less := func(a, b topRow) bool {
+		switch topSortKeys[s.sortKey] {
+		case "throughput":
+			return a.throughput > b.throughput
+		case "latency":
+			return a.latency > b.latency
+		case "failure":
+			return a.failure > b.failure
+		case "instances":
+			return a.instances > b.instances
+		}
+		return a.name < b.name
+	}
+	sort.Stable(topSorter{n: n, row: row, swap: swap, less: func(a, b topRow) bool {
+		if s.reverse {
+			return less(b, a)
+		}
+		return less(a, b)
+	}})
+}
+
+type topSorter struct {
+	n    int
+	row  func(int) topRow
+	swap func(i, j int)
+	less func(a, b topRow) bool
+}
+
+func (s topSorter) Len() int           { return s.n }
+func (s topSorter) Less(i, j int) bool { return s.less(s.row(i), s.row(j)) }
+func (s topSorter) Swap(i, j int)      { s.swap(i, j) }
+
+func formatLatency(d time.Duration) string {
+	return d.Round(100 * time.Microsecond).String()
+}
+
+// NewTopCmd returns pointer to a Command that displays a terminal dashboard of APM services
+func NewTopCmd(commands *Commands) *cli.Command {
+	return &cli.Command{
+		Name:  "top",
+		Usage: "display a continuously refreshing dashboard of service throughput, latency, failure rate and instances",
+		Description: "Commands are read a line at a time: type a command and press Enter. " +
+			"Enter a row number to show a service's transactions and dependencies, " +
+			"b to go back, s to change the sort column, r to reverse the sort order, and q to quit. " +
+			"If stdin is closed, the dashboard refreshes until interrupted.",
+		Action: commands.topCommand,
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:  "window",
+				Usage: "the time window over which to aggregate metrics",
+				Value: 5 * time.Minute,
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Usage: "how often to refresh the dashboard",
+				Value: 5 * time.Second,
+			},
+		},
+	}
+}
@@ -0,0 +1,141 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/elastic/apm-tools/pkg/apmclient"
+)
+
+func (cmd *Commands) transactionsCommand(ctx context.Context, c *cli.Command) error {
+	client, err := cmd.getClient()
+	if err != nil {
+		return err
+	}
+	groups, err := client.TransactionGroups(ctx, c.String("service"), sinceOptions(c)...)
+	if err != nil {
+		return err
+	}
+	switch format := c.String("format"); format {
+	case "json":
+		return printJSON(groups)
+	case "table":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tTYPE\tTPM\tP50\tP95\tP99\tFAILURE RATE")
+		for _, g := range groups {
+			fmt.Fprintf(tw, "%s\t%s\t%.1f\t%s\t%s\t%s\t%.2f%%\n",
+				g.Name, g.Type, g.ThroughputPerMinute,
+				g.LatencyP50, g.LatencyP95, g.LatencyP99,
+				g.FailureRate*100,
+			)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func (cmd *Commands) instancesCommand(ctx context.Context, c *cli.Command) error {
+	client, err := cmd.getClient()
+	if err != nil {
+		return err
+	}
+	instances, err := client.ServiceInstances(ctx, c.String("service"), sinceOptions(c)...)
+	if err != nil {
+		return err
+	}
+	switch format := c.String("format"); format {
+	case "json":
+		return printJSON(instances)
+	case "table":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NODE\tHOST\tCONTAINER\tLAST SEEN\tTPM")
+		for _, in := range instances {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.1f\n",
+				in.NodeName, in.HostName, in.ContainerID,
+				in.LastSeen.Format(time.RFC3339), in.ThroughputPerMinute,
+			)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// sinceOptions returns apmclient options restricting queries
+// to the duration specified by the "since" flag.
+func sinceOptions(c *cli.Command) []apmclient.Option {
+	if since := c.Duration("since"); since > 0 {
+		return []apmclient.Option{apmclient.WithTimeRange(time.Now().Add(-since), time.Time{})}
+	}
+	return nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func serviceQueryFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     "service",
+			Usage:    "the service.name to query",
+			Required: true,
+		},
+		&cli.DurationFlag{
+			Name:  "since",
+			Usage: "only consider data received within this duration. 0 means no time limit.",
+			Value: 15 * time.Minute,
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "set the output format to one of: table, json",
+			Value: "table",
+		},
+	}
+}
+
+// NewTransactionsCmd returns pointer to a Command that lists transaction groups of a service
+func NewTransactionsCmd(commands *Commands) *cli.Command {
+	return &cli.Command{
+		Name:   "transactions",
+		Usage:  "list transaction groups of a service with throughput, latency and failure rate",
+		Action: commands.transactionsCommand,
+		Flags:  serviceQueryFlags(),
+	}
+}
+
+// NewInstancesCmd returns pointer to a Command that lists instances of a service
+func NewInstancesCmd(commands *Commands) *cli.Command {
+	return &cli.Command{
+		Name:   "instances",
+		Usage:  "list instances of a service with last-seen times and throughput",
+		Action: commands.instancesCommand,
+		Flags:  serviceQueryFlags(),
+	}
+}
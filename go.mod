@@ -1,6 +1,6 @@
 module github.com/elastic/apm-tools
 
-go 1.22
+go 1.24
 
 require (
 	github.com/elastic/go-elasticsearch/v8 v8.13.1
@@ -19,10 +19,10 @@ package apmclient
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/tidwall/gjson"
@@ -35,29 +35,33 @@ import (
 )
 
 type Client struct {
-	es *elasticsearch.TypedClient
+	cfg  Config
+	es   *elasticsearch.TypedClient
+	http *http.Client
+
+	indicesMu sync.Mutex
+	indices   *Indices
 }
 
 // New returns a new Client for querying APM data.
 func New(cfg Config) (*Client, error) {
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: cfg.TLSSkipVerify}
-
-	es, err := elasticsearch.NewTypedClient(elasticsearch.Config{
-		Addresses: []string{cfg.ElasticsearchURL},
-		Username:  cfg.Username,
-		APIKey:    cfg.APIKey,
-		Password:  cfg.Password,
-		Transport: transport,
-	})
+	es, err := NewElasticsearchTypedClient(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("error creating Elasticsearch client: %w", err)
+		return nil, err
 	}
 	return &Client{
-		es: es,
+		cfg:  cfg,
+		es:   es,
+		http: &http.Client{Transport: cfg.httpTransport()},
 	}, nil
 }
 
+// ElasticsearchClient returns the typed Elasticsearch client used by c,
+// e.g. for sharing its connection with espoll.WrapTypedClient.
+func (c *Client) ElasticsearchClient() *elasticsearch.TypedClient {
+	return c.es
+}
+
 // GetElasticCloudAPMInput returns the APM configuration as defined
 // in the "elastic-cloud-apm" integration policy,
 func (c *Client) GetElasticCloudAPMInput(ctx context.Context) (gjson.Result, error) {
@@ -127,8 +131,18 @@ func (c *Client) CreateAgentAPIKey(ctx context.Context, expiration time.Duration
 
 // ServiceSummary returns ServiceSummary objects by aggregating `service_summary` metric sets.
 func (c *Client) ServiceSummary(ctx context.Context, options ...Option) ([]ServiceSummary, error) {
-	// TODO options
+	opts := newOptions(options)
+	indices, err := c.Indices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter := opts.filter()
+	// TODO select appropriate resolution according to the time filter.
+	filter = append(filter, metricsetFilter("service_summary", "1m")...)
 	req := &search.Request{
+		Query: &types.Query{
+			Bool: &types.BoolQuery{Filter: filter},
+		},
 		Aggregations: map[string]types.Aggregations{
 			"services": {
 				MultiTerms: &types.MultiTermsAggregation{
@@ -146,9 +160,8 @@ func (c *Client) ServiceSummary(ctx context.Context, options ...Option) ([]Servi
 			},
 		},
 	}
-	// TODO select appropriate resolution according to the time filter.
 	resp, err := c.es.Search().
-		Index("metrics-apm.service_summary.1m-*").
+		Index(indices.Metric).
 		Size(0).Request(req).Do(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error search service_summmary metrics")
@@ -168,6 +181,96 @@ func (c *Client) ServiceSummary(ctx context.Context, options ...Option) ([]Servi
 	return out, nil
 }
 
+// AgentSummary returns AgentSummary objects by aggregating agent and
+// runtime metadata of APM events, per service and environment.
+//
+// Both Elastic APM agents and OpenTelemetry SDKs are reported; fields
+// which do not apply to the agent are left empty.
+func (c *Client) AgentSummary(ctx context.Context, options ...Option) ([]AgentSummary, error) {
+	opts := newOptions(options)
+	indices, err := c.Indices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fields := []string{
+		"service.name",
+		"service.environment",
+		"agent.name",
+		"agent.version",
+		"service.language.name",
+		"service.language.version",
+		"service.runtime.name",
+		"service.runtime.version",
+		"telemetry.sdk.name",
+		"telemetry.sdk.language",
+		"telemetry.sdk.version",
+	}
+	terms := make([]types.MultiTermLookup, len(fields))
+	for i, field := range fields {
+		terms[i] = types.MultiTermLookup{Field: field}
+		if i > 0 {
+			// Only service.name is required; everything else
+			// may be missing depending on the agent.
+			terms[i].Missing = ""
+		}
+	}
+	size := 10000
+	req := &search.Request{
+		Query: &types.Query{
+			Bool: &types.BoolQuery{Filter: opts.filter()},
+		},
+		Aggregations: map[string]types.Aggregations{
+			"agents": {
+				MultiTerms: &types.MultiTermsAggregation{
+					Size:  &size,
+					Terms: terms,
+				},
+			},
+		},
+	}
+	resp, err := c.es.Search().
+		Index(indices.All()).
+		Size(0).Request(req).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error searching agent metadata: %w", err)
+	}
+
+	agentsAggregation := resp.Aggregations["agents"].(*types.MultiTermsAggregate)
+	buckets := agentsAggregation.Buckets.([]types.MultiTermsBucket)
+	out := make([]AgentSummary, len(buckets))
+	for i, bucket := range buckets {
+		key := func(i int) string {
+			s, _ := bucket.Key[i].(string)
+			return s
+		}
+		out[i] = AgentSummary{
+			ServiceName:     key(0),
+			Environment:     key(1),
+			AgentName:       key(2),
+			AgentVersion:    key(3),
+			LanguageName:    key(4),
+			LanguageVersion: key(5),
+			RuntimeName:     key(6),
+			RuntimeVersion:  key(7),
+			SDKName:         key(8),
+			SDKLanguage:     key(9),
+			SDKVersion:      key(10),
+			DocCount:        bucket.DocCount,
+		}
+	}
+	return out, nil
+}
+
+// metricsetFilter returns query clauses matching metric sets
+// with the given name and aggregation interval.
+func metricsetFilter(name, interval string) []types.Query {
+	return []types.Query{{
+		Term: map[string]types.TermQuery{"metricset.name": {Value: name}},
+	}, {
+		Term: map[string]types.TermQuery{"metricset.interval": {Value: interval}},
+	}}
+}
+
 var elasticsearchTimeUnits = []struct {
 	Duration time.Duration
 	Unit     string
@@ -0,0 +1,70 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestServiceSummary(t *testing.T) {
+	var query gjson.Result
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "/metrics-apm*/_search", r.URL.Path)
+		query = gjson.GetBytes(body, "query")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Write([]byte(`{"took":1,"timed_out":false,"hits":{"hits":[]},"aggregations":{"multi_terms#services":{"buckets":[
+			{"key":["svc","production","go","go"],"doc_count":1}
+		]}}}`))
+	}))
+	defer srv.Close()
+
+	client, err := New(Config{
+		ElasticsearchURL: srv.URL,
+		Indices:          Indices{Metric: "metrics-apm*"},
+	})
+	require.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	services, err := client.ServiceSummary(context.Background(), WithTimeRange(start, end))
+	require.NoError(t, err)
+	assert.Equal(t, []ServiceSummary{{
+		Name:        "svc",
+		Environment: "production",
+		Language:    "go",
+		Agent:       "go",
+	}}, services)
+
+	// The time range is applied along with the metricset filter.
+	assert.JSONEq(t, `[
+		{"range":{"@timestamp":{"gte":"2024-01-01T00:00:00Z","lte":"2024-01-01T01:00:00Z"}}},
+		{"term":{"metricset.name":{"value":"service_summary"}}},
+		{"term":{"metricset.interval":{"value":"1m"}}}
+	]`, query.Get("bool.filter").Raw)
+}
@@ -18,16 +18,24 @@
 package apmclient
 
 import (
+	"encoding/base64"
 	"fmt"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 )
 
 type Config struct {
 	// ElasticsearchURL holds the Elasticsearch URL.
+	//
+	// If this is unspecified, it will be derived from CloudID.
 	ElasticsearchURL string
 
+	// CloudID holds an Elastic Cloud deployment ID, from which
+	// ElasticsearchURL and KibanaURL may be derived.
+	CloudID string
+
 	// Username holds the Elasticsearch username for basic auth.
 	Username string
 
@@ -39,6 +47,25 @@ type Config struct {
 	// This will be set from $ELASTICSEARCH_API_KEY if specified.
 	APIKey string
 
+	// BearerToken holds a bearer token for authenticating with
+	// Elasticsearch and Kibana, such as a service account token.
+	//
+	// If APIKey is set, it takes precedence over BearerToken.
+	// Either takes precedence over Username and Password.
+	BearerToken string
+
+	// MaxRetries holds the maximum number of times a failed
+	// Elasticsearch request will be retried. If this is zero,
+	// DefaultMaxRetries is used; if it is negative, requests
+	// are not retried.
+	MaxRetries int
+
+	// MaxRetryBackoff holds the maximum time to wait between
+	// retries. The backoff starts at 500ms, and doubles with
+	// each retry until this is reached. If this is zero,
+	// DefaultMaxRetryBackoff is used.
+	MaxRetryBackoff time.Duration
+
 	// APMServerURL holds the APM Server URL.
 	//
 	// If this is unspecified, it will be derived from
@@ -51,6 +78,13 @@ type Config struct {
 	// ElasticsearchURL if that is an Elastic Cloud URL.
 	KibanaURL string
 
+	// Indices holds explicit index patterns for querying APM data.
+	//
+	// Any patterns left unspecified will be taken from Kibana's
+	// APM index settings if KibanaURL is set, or otherwise from
+	// DefaultIndices. See Client.Indices.
+	Indices Indices
+
 	// TLSSkipVerify determines if TLS certificate
 	// verification is skipped or not. Default to false.
 	//
@@ -58,8 +92,20 @@ type Config struct {
 	// TLS_SKIP_VERIFY env var.
 	// Any value different from "" is considered true.
 	TLSSkipVerify bool
+
+	// kibanaURLInferred records whether KibanaURL was derived
+	// by InferElasticCloudURLs rather than set explicitly.
+	kibanaURLInferred bool
 }
 
+const (
+	// DefaultMaxRetries is the default value for Config.MaxRetries.
+	DefaultMaxRetries = 5
+
+	// DefaultMaxRetryBackoff is the default value for Config.MaxRetryBackoff.
+	DefaultMaxRetryBackoff = 10 * time.Second
+)
+
 // NewConfig returns a Config intialised from environment variables.
 func NewConfig() (Config, error) {
 	cfg := Config{}
@@ -71,11 +117,19 @@ func NewConfig() (Config, error) {
 // variables:
 //
 //   - ElasticsearchURL is set from $ELASTICSEARCH_URL
+//   - CloudID is set from $ELASTIC_CLOUD_ID
 //   - Username is set from $ELASTICSEARCH_USERNAME
 //   - Password is set from $ELASTICSEARCH_PASSWORD
 //   - API Key is set from $ELASTICSEARCH_API_KEY
+//   - BearerToken is set from $ELASTICSEARCH_BEARER_TOKEN,
+//     or $ELASTICSEARCH_SERVICE_TOKEN
 //   - APMServerURL is set from $ELASTIC_APM_SERVER_URL
 //   - KibanaURL is set from $KIBANA_URL
+//   - Indices are set from $APM_TRANSACTION_INDICES, $APM_SPAN_INDICES,
+//     $APM_ERROR_INDICES, and $APM_METRIC_INDICES
+//
+// If ElasticsearchURL is unspecified and CloudID is set, then the
+// Elasticsearch and Kibana URLs are derived from the cloud ID.
 //
 // If $ELASTIC_APM_SERVER_URL is unspecified, and ElasticsearchURL
 // holds an Elastic Cloud-based URL, then the APM Server URL is
@@ -85,6 +139,9 @@ func (cfg *Config) Finalize() error {
 	if cfg.ElasticsearchURL == "" {
 		cfg.ElasticsearchURL = os.Getenv("ELASTICSEARCH_URL")
 	}
+	if cfg.CloudID == "" {
+		cfg.CloudID = os.Getenv("ELASTIC_CLOUD_ID")
+	}
 	if cfg.Username == "" {
 		cfg.Username = os.Getenv("ELASTICSEARCH_USERNAME")
 	}
@@ -94,12 +151,30 @@ func (cfg *Config) Finalize() error {
 	if cfg.APIKey == "" {
 		cfg.APIKey = os.Getenv("ELASTICSEARCH_API_KEY")
 	}
+	if cfg.BearerToken == "" {
+		cfg.BearerToken = os.Getenv("ELASTICSEARCH_BEARER_TOKEN")
+	}
+	if cfg.BearerToken == "" {
+		cfg.BearerToken = os.Getenv("ELASTICSEARCH_SERVICE_TOKEN")
+	}
 	if cfg.APMServerURL == "" {
 		cfg.APMServerURL = os.Getenv("ELASTIC_APM_SERVER_URL")
 	}
 	if cfg.KibanaURL == "" {
 		cfg.KibanaURL = os.Getenv("KIBANA_URL")
 	}
+	if cfg.Indices.Transaction == "" {
+		cfg.Indices.Transaction = os.Getenv("APM_TRANSACTION_INDICES")
+	}
+	if cfg.Indices.Span == "" {
+		cfg.Indices.Span = os.Getenv("APM_SPAN_INDICES")
+	}
+	if cfg.Indices.Error == "" {
+		cfg.Indices.Error = os.Getenv("APM_ERROR_INDICES")
+	}
+	if cfg.Indices.Metric == "" {
+		cfg.Indices.Metric = os.Getenv("APM_METRIC_INDICES")
+	}
 	if env := os.Getenv("TLS_SKIP_VERIFY"); !cfg.TLSSkipVerify && env != "" {
 		cfg.TLSSkipVerify = true
 	}
@@ -110,7 +185,21 @@ func (cfg *Config) Finalize() error {
 // and KibanaURL (if they are empty), by checking if ElasticsearchURL
 // matches an Elastic Cloud URL pattern, and deriving the other URLs
 // from that.
+//
+// If ElasticsearchURL is empty and CloudID is set, ElasticsearchURL
+// and KibanaURL (if empty) are first derived from CloudID.
 func (cfg *Config) InferElasticCloudURLs() error {
+	if cfg.ElasticsearchURL == "" && cfg.CloudID != "" {
+		esURL, kibanaURL, err := parseCloudID(cfg.CloudID)
+		if err != nil {
+			return fmt.Errorf("error parsing CloudID: %w", err)
+		}
+		cfg.ElasticsearchURL = esURL
+		if cfg.KibanaURL == "" && kibanaURL != "" {
+			cfg.KibanaURL = kibanaURL
+			cfg.kibanaURLInferred = true
+		}
+	}
 	if cfg.ElasticsearchURL == "" {
 		return nil
 	}
@@ -134,8 +223,34 @@ func (cfg *Config) InferElasticCloudURLs() error {
 			if cfg.KibanaURL == "" {
 				url.Host = fmt.Sprintf("%s.kb.%s", alias, remainder)
 				cfg.KibanaURL = url.String()
+				cfg.kibanaURLInferred = true
 			}
 		}
 	}
 	return nil
 }
+
+// parseCloudID parses an Elastic Cloud ID of the form
+// <name>:<base64(host$es_id$kibana_id)>, returning the
+// Elasticsearch and Kibana URLs. The Kibana URL will be
+// empty if the ID does not include a Kibana ID.
+func parseCloudID(cloudID string) (esURL, kibanaURL string, err error) {
+	_, encoded, ok := strings.Cut(cloudID, ":")
+	if !ok {
+		return "", "", fmt.Errorf("unexpected format %q", cloudID)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.Split(string(decoded), "$")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("unexpected format %q", decoded)
+	}
+	host := parts[0]
+	esURL = fmt.Sprintf("https://%s.%s", parts[1], host)
+	if len(parts) > 2 && parts[2] != "" {
+		kibanaURL = fmt.Sprintf("https://%s.%s", parts[2], host)
+	}
+	return esURL, kibanaURL, nil
+}
@@ -0,0 +1,109 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmclient
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCloudID(t *testing.T) {
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+	for name, test := range map[string]struct {
+		cloudID   string
+		esURL     string
+		kibanaURL string
+		err       string
+	}{
+		"es_and_kibana": {
+			cloudID:   "name:" + encode("us-east-1.aws.found.io$esid$kbid"),
+			esURL:     "https://esid.us-east-1.aws.found.io",
+			kibanaURL: "https://kbid.us-east-1.aws.found.io",
+		},
+		"host_with_port": {
+			cloudID:   "name:" + encode("us-east-1.aws.found.io:9243$esid$kbid"),
+			esURL:     "https://esid.us-east-1.aws.found.io:9243",
+			kibanaURL: "https://kbid.us-east-1.aws.found.io:9243",
+		},
+		"no_kibana": {
+			cloudID: "name:" + encode("us-east-1.aws.found.io$esid"),
+			esURL:   "https://esid.us-east-1.aws.found.io",
+		},
+		"empty_kibana": {
+			cloudID: "name:" + encode("us-east-1.aws.found.io$esid$"),
+			esURL:   "https://esid.us-east-1.aws.found.io",
+		},
+		"missing_name": {
+			cloudID: encode("us-east-1.aws.found.io$esid$kbid"),
+			err:     "unexpected format",
+		},
+		"invalid_base64": {
+			cloudID: "name:not base64!",
+			err:     "illegal base64 data",
+		},
+		"missing_es_id": {
+			cloudID: "name:" + encode("us-east-1.aws.found.io"),
+			err:     `unexpected format "us-east-1.aws.found.io"`,
+		},
+		"empty_es_id": {
+			cloudID: "name:" + encode("us-east-1.aws.found.io$$kbid"),
+			err:     "unexpected format",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			esURL, kibanaURL, err := parseCloudID(test.cloudID)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.esURL, esURL)
+			assert.Equal(t, test.kibanaURL, kibanaURL)
+		})
+	}
+}
+
+func TestInferElasticCloudURLs(t *testing.T) {
+	cloudID := "name:" + base64.StdEncoding.EncodeToString([]byte("us-east-1.aws.found.io$esid$kbid"))
+
+	cfg := Config{CloudID: cloudID}
+	require.NoError(t, cfg.InferElasticCloudURLs())
+	assert.Equal(t, "https://esid.us-east-1.aws.found.io", cfg.ElasticsearchURL)
+	assert.Equal(t, "https://kbid.us-east-1.aws.found.io", cfg.KibanaURL)
+	assert.True(t, cfg.kibanaURLInferred)
+
+	// Explicit URLs take precedence over CloudID.
+	cfg = Config{CloudID: cloudID, ElasticsearchURL: "http://localhost:9200", KibanaURL: "http://localhost:5601"}
+	require.NoError(t, cfg.InferElasticCloudURLs())
+	assert.Equal(t, "http://localhost:9200", cfg.ElasticsearchURL)
+	assert.Equal(t, "http://localhost:5601", cfg.KibanaURL)
+	assert.False(t, cfg.kibanaURLInferred)
+
+	cfg = Config{ElasticsearchURL: "https://alias.es.us-east-1.aws.found.io:443"}
+	require.NoError(t, cfg.InferElasticCloudURLs())
+	assert.Equal(t, "https://alias.apm.us-east-1.aws.found.io:443", cfg.APMServerURL)
+	assert.Equal(t, "https://alias.kb.us-east-1.aws.found.io:443", cfg.KibanaURL)
+
+	cfg = Config{CloudID: "name:" + base64.StdEncoding.EncodeToString([]byte("host"))}
+	assert.ErrorContains(t, cfg.InferElasticCloudURLs(), "error parsing CloudID")
+}
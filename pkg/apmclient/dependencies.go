@@ -0,0 +1,76 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// ServiceDependencies returns ServiceDependency objects for the given
+// service by aggregating `service_destination` metric sets.
+func (c *Client) ServiceDependencies(ctx context.Context, serviceName string, options ...Option) ([]ServiceDependency, error) {
+	size := 1000
+	resourceField := "span.destination.service.resource"
+	countField := "span.destination.service.response_time.count"
+	sumField := "span.destination.service.response_time.sum.us"
+	resp, window, err := c.searchMetrics(ctx, "service_destination", serviceFilter(serviceName), newOptions(options), map[string]types.Aggregations{
+		"dependencies": {
+			Terms: &types.TermsAggregation{Field: &resourceField, Size: &size},
+			Aggregations: map[string]types.Aggregations{
+				"count":  {Sum: &types.SumAggregation{Field: &countField}},
+				"sum_us": {Sum: &types.SumAggregation{Field: &sumField}},
+				"failure": {
+					Filter: &types.Query{
+						Term: map[string]types.TermQuery{"event.outcome": {Value: "failure"}},
+					},
+					Aggregations: map[string]types.Aggregations{
+						"count": {Sum: &types.SumAggregation{Field: &countField}},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching service_destination metrics: %w", err)
+	}
+
+	dependenciesAggregation := resp.Aggregations["dependencies"].(*types.StringTermsAggregate)
+	buckets := dependenciesAggregation.Buckets.([]types.StringTermsBucket)
+	out := make([]ServiceDependency, len(buckets))
+	for i, bucket := range buckets {
+		resource, _ := bucket.Key.(string)
+		count := int64(bucket.Aggregations["count"].(*types.SumAggregate).Value)
+		sumUS := float64(bucket.Aggregations["sum_us"].(*types.SumAggregate).Value)
+		failure := bucket.Aggregations["failure"].(*types.FilterAggregate)
+		failureCount := float64(failure.Aggregations["count"].(*types.SumAggregate).Value)
+		out[i] = ServiceDependency{
+			Resource:            resource,
+			Count:               count,
+			ThroughputPerMinute: perMinute(count, window),
+		}
+		if count > 0 {
+			out[i].LatencyAvg = time.Duration(sumUS / float64(count) * float64(time.Microsecond))
+			out[i].FailureRate = failureCount / float64(count)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,110 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmclient
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// ElasticsearchConfig returns an elasticsearch.Config for connecting to
+// Elasticsearch with the URL, credentials, TLS and retry settings in cfg.
+//
+// ElasticsearchURL may hold a comma-separated list of URLs.
+func (cfg Config) ElasticsearchConfig() elasticsearch.Config {
+	esConfig := elasticsearch.Config{
+		Addresses:    strings.Split(cfg.ElasticsearchURL, ","),
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		APIKey:       cfg.APIKey,
+		ServiceToken: cfg.BearerToken,
+		Transport:    cfg.httpTransport(),
+		MaxRetries:   cfg.MaxRetries,
+		RetryBackoff: cfg.retryBackoff,
+	}
+	switch {
+	case cfg.MaxRetries == 0:
+		esConfig.MaxRetries = DefaultMaxRetries
+	case cfg.MaxRetries < 0:
+		// The transport makes MaxRetries+1 attempts, even
+		// with DisableRetry, so it must not be negative.
+		esConfig.MaxRetries = 0
+		esConfig.DisableRetry = true
+	}
+	return esConfig
+}
+
+// NewElasticsearchClient returns an Elasticsearch client configured
+// with cfg.ElasticsearchConfig.
+func NewElasticsearchClient(cfg Config) (*elasticsearch.Client, error) {
+	client, err := elasticsearch.NewClient(cfg.ElasticsearchConfig())
+	if err != nil {
+		return nil, fmt.Errorf("error creating Elasticsearch client: %w", err)
+	}
+	return client, nil
+}
+
+// NewElasticsearchTypedClient returns a typed Elasticsearch client
+// configured with cfg.ElasticsearchConfig.
+func NewElasticsearchTypedClient(cfg Config) (*elasticsearch.TypedClient, error) {
+	client, err := elasticsearch.NewTypedClient(cfg.ElasticsearchConfig())
+	if err != nil {
+		return nil, fmt.Errorf("error creating Elasticsearch client: %w", err)
+	}
+	return client, nil
+}
+
+// httpTransport returns an HTTP transport for connecting to
+// Elasticsearch and Kibana with the TLS settings in cfg.
+func (cfg Config) httpTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: cfg.TLSSkipVerify}
+	return transport
+}
+
+// retryBackoff returns the time to wait before the given retry attempt,
+// starting at 500ms and doubling up to cfg.MaxRetryBackoff.
+func (cfg Config) retryBackoff(attempt int) time.Duration {
+	maxBackoff := cfg.MaxRetryBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxRetryBackoff
+	}
+	backoff := (500 * time.Millisecond) * (1 << (attempt - 1))
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// setAuthHeader sets the Authorization header of req
+// using the credentials in cfg, in order of precedence.
+func (cfg Config) setAuthHeader(req *http.Request) {
+	switch {
+	case cfg.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+cfg.APIKey)
+	case cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+cfg.BearerToken)
+	case cfg.Username != "":
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+}
@@ -0,0 +1,136 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmclient
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+func TestElasticsearchConfig(t *testing.T) {
+	for name, test := range map[string]struct {
+		cfg          Config
+		addresses    []string
+		maxRetries   int
+		disableRetry bool
+	}{
+		"default_retries": {
+			cfg:        Config{ElasticsearchURL: "http://localhost:9200"},
+			addresses:  []string{"http://localhost:9200"},
+			maxRetries: DefaultMaxRetries,
+		},
+		"max_retries": {
+			cfg:        Config{ElasticsearchURL: "http://es1:9200,http://es2:9200", MaxRetries: 2},
+			addresses:  []string{"http://es1:9200", "http://es2:9200"},
+			maxRetries: 2,
+		},
+		"disable_retries": {
+			cfg:          Config{ElasticsearchURL: "http://localhost:9200", MaxRetries: -1},
+			addresses:    []string{"http://localhost:9200"},
+			maxRetries:   0,
+			disableRetry: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			esConfig := test.cfg.ElasticsearchConfig()
+			assert.Equal(t, test.addresses, esConfig.Addresses)
+			assert.Equal(t, test.maxRetries, esConfig.MaxRetries)
+			assert.Equal(t, test.disableRetry, esConfig.DisableRetry)
+			assert.NotNil(t, esConfig.RetryBackoff)
+		})
+	}
+
+	// Requests are attempted once with retries disabled.
+	var attempts int
+	esConfig := Config{ElasticsearchURL: "http://localhost:9200", MaxRetries: -1}.ElasticsearchConfig()
+	esConfig.Transport = roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		attempts++
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{"X-Elastic-Product": []string{"Elasticsearch"}},
+			Body:       http.NoBody,
+		}, nil
+	})
+	client, err := elasticsearch.NewClient(esConfig)
+	require.NoError(t, err)
+	res, err := client.Info()
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, 1, attempts)
+
+	cfg := Config{
+		Username:      "user",
+		Password:      "pass",
+		APIKey:        "key",
+		BearerToken:   "token",
+		TLSSkipVerify: true,
+	}
+	esConfig = cfg.ElasticsearchConfig()
+	assert.Equal(t, "user", esConfig.Username)
+	assert.Equal(t, "pass", esConfig.Password)
+	assert.Equal(t, "key", esConfig.APIKey)
+	assert.Equal(t, "token", esConfig.ServiceToken)
+	if assert.IsType(t, &http.Transport{}, esConfig.Transport) {
+		assert.True(t, esConfig.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for name, test := range map[string]struct {
+		maxBackoff time.Duration
+		expected   []time.Duration
+	}{
+		"default": {
+			expected: []time.Duration{
+				500 * time.Millisecond, time.Second, 2 * time.Second,
+				4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second,
+			},
+		},
+		"max_backoff": {
+			maxBackoff: 3 * time.Second,
+			expected: []time.Duration{
+				500 * time.Millisecond, time.Second, 2 * time.Second,
+				3 * time.Second, 3 * time.Second,
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := Config{MaxRetryBackoff: test.maxBackoff}
+			for i, expected := range test.expected {
+				assert.Equal(t, expected, cfg.retryBackoff(i+1), "attempt %d", i+1)
+			}
+		})
+	}
+
+	// Large attempts must not overflow into negative or zero backoffs.
+	assert.Equal(t, DefaultMaxRetryBackoff, Config{}.retryBackoff(100))
+}
+
+// roundTripperFunc is an http.RoundTripper implemented by a function.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
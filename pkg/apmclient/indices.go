@@ -0,0 +1,169 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Indices holds the index patterns to search for each type of APM data.
+//
+// Each field holds a comma-separated list of index patterns, and may
+// include cross-cluster search expressions.
+type Indices struct {
+	Transaction string `json:"transaction"`
+	Span        string `json:"span"`
+	Error       string `json:"error"`
+	Metric      string `json:"metric"`
+
+	// Warning is set by Client.Indices when Kibana's APM index
+	// settings could not be read, and DefaultIndices were used in
+	// their place. It is ignored in Config.Indices.
+	Warning string `json:"-"`
+}
+
+// DefaultIndices holds the index patterns Kibana uses when
+// the APM index settings have not been modified.
+var DefaultIndices = Indices{
+	Transaction: "traces-apm*,apm-*",
+	Span:        "traces-apm*,apm-*",
+	Error:       "logs-apm*,apm-*",
+	Metric:      "metrics-apm*,apm-*",
+}
+
+// All returns the deduplicated union of all index patterns in i,
+// joined with commas.
+func (i Indices) All() string {
+	var patterns []string
+	seen := make(map[string]bool)
+	for _, list := range []string{i.Transaction, i.Span, i.Error, i.Metric} {
+		for _, pattern := range strings.Split(list, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" && !seen[pattern] {
+				seen[pattern] = true
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+	return strings.Join(patterns, ",")
+}
+
+// merge returns i with any empty fields set from other.
+func (i Indices) merge(other Indices) Indices {
+	if i.Transaction == "" {
+		i.Transaction = other.Transaction
+	}
+	if i.Span == "" {
+		i.Span = other.Span
+	}
+	if i.Error == "" {
+		i.Error = other.Error
+	}
+	if i.Metric == "" {
+		i.Metric = other.Metric
+	}
+	return i
+}
+
+func (i Indices) complete() bool {
+	return i.Transaction != "" && i.Span != "" && i.Error != "" && i.Metric != ""
+}
+
+// Indices returns the index patterns to use for querying APM data.
+//
+// Patterns explicitly set in Config.Indices take precedence. Any others
+// are taken from Kibana's APM index settings if Config.KibanaURL is set,
+// and otherwise from DefaultIndices. The result is cached for the
+// lifetime of the Client.
+//
+// If the Kibana URL was inferred from the Elasticsearch URL or cloud ID
+// rather than set explicitly, failure to read the settings from Kibana
+// is not an error, as the credentials may be valid only for Elasticsearch.
+// DefaultIndices are used instead, and the failure is described by the
+// result's Warning field for the caller to report.
+func (c *Client) Indices(ctx context.Context) (Indices, error) {
+	c.indicesMu.Lock()
+	defer c.indicesMu.Unlock()
+	if c.indices != nil {
+		return *c.indices, nil
+	}
+	indices := c.cfg.Indices
+	indices.Warning = ""
+	if !indices.complete() && c.cfg.KibanaURL != "" {
+		kibanaIndices, err := c.getKibanaAPMIndices(ctx)
+		switch {
+		case err == nil:
+			indices = indices.merge(kibanaIndices)
+		case c.cfg.kibanaURLInferred && ctx.Err() == nil:
+			indices.Warning = err.Error()
+		default:
+			return Indices{}, err
+		}
+	}
+	indices = indices.merge(DefaultIndices)
+	c.indices = &indices
+	return indices, nil
+}
+
+// kibanaAPMIndicesPaths holds the Kibana API paths for APM index settings,
+// in order of preference. The path changed in Kibana 8.12.
+var kibanaAPMIndicesPaths = []string{
+	"/internal/apm-sources/settings/apm-indices",
+	"/internal/apm/settings/apm-indices",
+}
+
+var errKibanaNotFound = errors.New("not found")
+
+func (c *Client) getKibanaAPMIndices(ctx context.Context) (Indices, error) {
+	var err error
+	for _, path := range kibanaAPMIndicesPaths {
+		var indices Indices
+		if err = c.getKibana(ctx, path, &indices); err == nil {
+			return indices, nil
+		} else if !errors.Is(err, errKibanaNotFound) {
+			break
+		}
+	}
+	return Indices{}, fmt.Errorf("error getting APM index settings from Kibana: %w", err)
+}
+
+func (c *Client) getKibana(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.cfg.KibanaURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("kbn-xsrf", "true")
+	req.Header.Set("elastic-api-version", "1")
+	c.cfg.setAuthHeader(req)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s: %w", path, errKibanaNotFound)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%s: Kibana responded with %q", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
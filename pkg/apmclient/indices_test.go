@@ -0,0 +1,97 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndicesKibana(t *testing.T) {
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"transaction":"traces-custom*","span":"traces-custom*","error":"logs-custom*","metric":"metrics-custom*"}`))
+	}))
+	defer srv.Close()
+
+	indices := func(t *testing.T, cfg Config) (Indices, error) {
+		cfg.ElasticsearchURL = srv.URL
+		client, err := New(cfg)
+		require.NoError(t, err)
+		return client.Indices(context.Background())
+	}
+
+	t.Run("settings", func(t *testing.T) {
+		status = http.StatusOK
+		got, err := indices(t, Config{
+			KibanaURL: srv.URL,
+			Indices:   Indices{Error: "logs-override*"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, Indices{
+			Transaction: "traces-custom*",
+			Span:        "traces-custom*",
+			Error:       "logs-override*",
+			Metric:      "metrics-custom*",
+		}, got)
+	})
+
+	t.Run("explicit_url_error", func(t *testing.T) {
+		status = http.StatusForbidden
+		_, err := indices(t, Config{KibanaURL: srv.URL})
+		assert.ErrorContains(t, err, "403 Forbidden")
+	})
+
+	t.Run("inferred_url_error", func(t *testing.T) {
+		status = http.StatusForbidden
+		got, err := indices(t, Config{KibanaURL: srv.URL, kibanaURLInferred: true})
+		require.NoError(t, err)
+		assert.Contains(t, got.Warning, "403 Forbidden")
+		got.Warning = ""
+		assert.Equal(t, DefaultIndices, got)
+	})
+
+	t.Run("inferred_url_unreachable", func(t *testing.T) {
+		got, err := indices(t, Config{KibanaURL: "http://127.0.0.1:1", kibanaURLInferred: true})
+		require.NoError(t, err)
+		assert.NotEmpty(t, got.Warning)
+		got.Warning = ""
+		assert.Equal(t, DefaultIndices, got)
+	})
+}
+
+func TestInferElasticCloudURLsKibana(t *testing.T) {
+	cfg := Config{ElasticsearchURL: "https://alias.es.example.com:443"}
+	require.NoError(t, cfg.InferElasticCloudURLs())
+	assert.Equal(t, "https://alias.kb.example.com:443", cfg.KibanaURL)
+	assert.True(t, cfg.kibanaURLInferred)
+
+	cfg = Config{ElasticsearchURL: "https://alias.es.example.com:443", KibanaURL: "https://kibana.example.com"}
+	require.NoError(t, cfg.InferElasticCloudURLs())
+	assert.Equal(t, "https://kibana.example.com", cfg.KibanaURL)
+	assert.False(t, cfg.kibanaURLInferred)
+}
@@ -17,7 +17,50 @@
 
 package apmclient
 
+import (
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
 type options struct {
+	start, end time.Time
 }
 
 type Option func(*options)
+
+// WithTimeRange restricts queries to documents with a @timestamp
+// within [start, end]. A zero start or end leaves that side unbounded.
+func WithTimeRange(start, end time.Time) Option {
+	return func(opts *options) {
+		opts.start = start
+		opts.end = end
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// filter returns the query clauses implied by o.
+func (o options) filter() []types.Query {
+	if o.start.IsZero() && o.end.IsZero() {
+		return nil
+	}
+	var r types.DateRangeQuery
+	if !o.start.IsZero() {
+		gte := o.start.UTC().Format(time.RFC3339Nano)
+		r.Gte = &gte
+	}
+	if !o.end.IsZero() {
+		lte := o.end.UTC().Format(time.RFC3339Nano)
+		r.Lte = &lte
+	}
+	return []types.Query{{
+		Range: map[string]types.RangeQuery{"@timestamp": r},
+	}}
+}
@@ -0,0 +1,264 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmclient
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// ServiceMetrics returns ServiceMetrics objects for all services
+// by aggregating `transaction` metric sets.
+func (c *Client) ServiceMetrics(ctx context.Context, options ...Option) ([]ServiceMetrics, error) {
+	size := 1000
+	serviceNameField := "service.name"
+	nodeNameField := "service.node.name"
+	aggs := transactionStatsAggregations()
+	aggs["instances"] = types.Aggregations{
+		Cardinality: &types.CardinalityAggregation{Field: &nodeNameField},
+	}
+	resp, window, err := c.searchMetrics(ctx, "transaction", nil, newOptions(options), map[string]types.Aggregations{
+		"services": {
+			Terms:        &types.TermsAggregation{Field: &serviceNameField, Size: &size},
+			Aggregations: aggs,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching transaction metrics: %w", err)
+	}
+
+	servicesAggregation := resp.Aggregations["services"].(*types.StringTermsAggregate)
+	buckets := servicesAggregation.Buckets.([]types.StringTermsBucket)
+	out := make([]ServiceMetrics, len(buckets))
+	for i, bucket := range buckets {
+		name, _ := bucket.Key.(string)
+		instances := bucket.Aggregations["instances"].(*types.CardinalityAggregate)
+		out[i] = ServiceMetrics{
+			Name:                name,
+			Count:               bucket.DocCount,
+			ThroughputPerMinute: perMinute(bucket.DocCount, window),
+			Instances:           instances.Value,
+		}
+		out[i].LatencyP50, out[i].LatencyP95, out[i].LatencyP99, out[i].FailureRate = decodeTransactionStats(bucket.Aggregations)
+	}
+	return out, nil
+}
+
+// TransactionGroups returns TransactionGroup objects for the given service
+// by aggregating `transaction` metric sets.
+func (c *Client) TransactionGroups(ctx context.Context, serviceName string, options ...Option) ([]TransactionGroup, error) {
+	size := 1000
+	resp, window, err := c.searchMetrics(ctx, "transaction", serviceFilter(serviceName), newOptions(options), map[string]types.Aggregations{
+		"groups": {
+			MultiTerms: &types.MultiTermsAggregation{
+				Size: &size,
+				Terms: []types.MultiTermLookup{{
+					Field: "transaction.name",
+				}, {
+					Field:   "transaction.type",
+					Missing: "",
+				}},
+			},
+			Aggregations: transactionStatsAggregations(),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching transaction metrics: %w", err)
+	}
+
+	groupsAggregation := resp.Aggregations["groups"].(*types.MultiTermsAggregate)
+	buckets := groupsAggregation.Buckets.([]types.MultiTermsBucket)
+	out := make([]TransactionGroup, len(buckets))
+	for i, bucket := range buckets {
+		name, _ := bucket.Key[0].(string)
+		typ, _ := bucket.Key[1].(string)
+		out[i] = TransactionGroup{
+			Name:                name,
+			Type:                typ,
+			Count:               bucket.DocCount,
+			ThroughputPerMinute: perMinute(bucket.DocCount, window),
+		}
+		out[i].LatencyP50, out[i].LatencyP95, out[i].LatencyP99, out[i].FailureRate = decodeTransactionStats(bucket.Aggregations)
+	}
+	return out, nil
+}
+
+// ServiceInstances returns ServiceInstance objects for the given service
+// by aggregating `transaction` metric sets per service node, host and
+// container.
+func (c *Client) ServiceInstances(ctx context.Context, serviceName string, options ...Option) ([]ServiceInstance, error) {
+	size := 1000
+	timestampField := "@timestamp"
+	resp, window, err := c.searchMetrics(ctx, "transaction", serviceFilter(serviceName), newOptions(options), map[string]types.Aggregations{
+		"instances": {
+			MultiTerms: &types.MultiTermsAggregation{
+				Size: &size,
+				Terms: []types.MultiTermLookup{{
+					Field:   "service.node.name",
+					Missing: "",
+				}, {
+					Field:   "host.name",
+					Missing: "",
+				}, {
+					Field:   "container.id",
+					Missing: "",
+				}},
+			},
+			Aggregations: map[string]types.Aggregations{
+				"last_seen": {Max: &types.MaxAggregation{Field: &timestampField}},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching transaction metrics: %w", err)
+	}
+
+	instancesAggregation := resp.Aggregations["instances"].(*types.MultiTermsAggregate)
+	buckets := instancesAggregation.Buckets.([]types.MultiTermsBucket)
+	out := make([]ServiceInstance, len(buckets))
+	for i, bucket := range buckets {
+		nodeName, _ := bucket.Key[0].(string)
+		hostName, _ := bucket.Key[1].(string)
+		containerID, _ := bucket.Key[2].(string)
+		lastSeen := bucket.Aggregations["last_seen"].(*types.MaxAggregate)
+		out[i] = ServiceInstance{
+			NodeName:            nodeName,
+			HostName:            hostName,
+			ContainerID:         containerID,
+			LastSeen:            time.UnixMilli(int64(lastSeen.Value)).UTC(),
+			Count:               bucket.DocCount,
+			ThroughputPerMinute: perMinute(bucket.DocCount, window),
+		}
+	}
+	return out, nil
+}
+
+// transactionStatsAggregations returns the sub-aggregations
+// decoded by decodeTransactionStats.
+func transactionStatsAggregations() map[string]types.Aggregations {
+	keyed := false
+	durationField := "transaction.duration.histogram"
+	return map[string]types.Aggregations{
+		"latency": {
+			Percentiles: &types.PercentilesAggregation{
+				Field:    &durationField,
+				Keyed:    &keyed,
+				Percents: []types.Float64{50, 95, 99},
+			},
+		},
+		"outcome": {
+			Filter: &types.Query{
+				Terms: &types.TermsQuery{TermsQuery: map[string]types.TermsQueryField{
+					"event.outcome": []types.FieldValue{"success", "failure"},
+				}},
+			},
+		},
+		"failure": {
+			Filter: &types.Query{
+				Term: map[string]types.TermQuery{"event.outcome": {Value: "failure"}},
+			},
+		},
+	}
+}
+
+// decodeTransactionStats decodes latency percentiles and the failure
+// rate from the results of transactionStatsAggregations.
+func decodeTransactionStats(aggs map[string]types.Aggregate) (p50, p95, p99 time.Duration, failureRate float64) {
+	latency := aggs["latency"].(*types.TDigestPercentilesAggregate)
+	if items, ok := latency.Values.([]types.ArrayPercentilesItem); ok {
+		for _, item := range items {
+			// transaction.duration.histogram is in microseconds.
+			d := time.Duration(float64(item.Value) * float64(time.Microsecond))
+			switch percent, _ := strconv.ParseFloat(item.Key, 64); percent {
+			case 50:
+				p50 = d
+			case 95:
+				p95 = d
+			case 99:
+				p99 = d
+			}
+		}
+	}
+	outcome := aggs["outcome"].(*types.FilterAggregate)
+	failure := aggs["failure"].(*types.FilterAggregate)
+	if outcome.DocCount > 0 {
+		failureRate = float64(failure.DocCount) / float64(outcome.DocCount)
+	}
+	return p50, p95, p99, failureRate
+}
+
+func serviceFilter(serviceName string) []types.Query {
+	return []types.Query{{
+		Term: map[string]types.TermQuery{"service.name": {Value: serviceName}},
+	}}
+}
+
+// searchMetrics searches 1m metric sets with the given name and filter,
+// returning the response with the specified aggregations and the duration
+// of the time window covered by the search.
+func (c *Client) searchMetrics(
+	ctx context.Context,
+	metricset string,
+	filter []types.Query,
+	opts options,
+	aggs map[string]types.Aggregations,
+) (*search.Response, time.Duration, error) {
+	indices, err := c.Indices(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	timestampField := "@timestamp"
+	aggs["earliest"] = types.Aggregations{Min: &types.MinAggregation{Field: &timestampField}}
+	filter = append(filter, opts.filter()...)
+	// TODO select appropriate resolution according to the time filter.
+	filter = append(filter, metricsetFilter(metricset, "1m")...)
+	req := &search.Request{
+		Query: &types.Query{
+			Bool: &types.BoolQuery{Filter: filter},
+		},
+		Aggregations: aggs,
+	}
+	resp, err := c.es.Search().
+		Index(indices.Metric).
+		Size(0).Request(req).Do(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start, end := opts.start, opts.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if start.IsZero() {
+		earliest := resp.Aggregations["earliest"].(*types.MinAggregate)
+		start = time.UnixMilli(int64(earliest.Value))
+	}
+	return resp, end.Sub(start), nil
+}
+
+func perMinute(count int64, window time.Duration) float64 {
+	if window < time.Minute {
+		window = time.Minute
+	}
+	return float64(count) / window.Minutes()
+}
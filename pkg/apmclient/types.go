@@ -17,6 +17,11 @@
 
 package apmclient
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type APIKey struct {
 	Encoded string
 }
@@ -27,3 +32,112 @@ type ServiceSummary struct {
 	Agent       string
 	Language    string
 }
+
+// AgentSummary describes an agent reporting data for a service
+// in a specific environment.
+type AgentSummary struct {
+	ServiceName     string `json:"service_name"`
+	Environment     string `json:"environment,omitempty"`
+	AgentName       string `json:"agent_name,omitempty"`
+	AgentVersion    string `json:"agent_version,omitempty"`
+	LanguageName    string `json:"language_name,omitempty"`
+	LanguageVersion string `json:"language_version,omitempty"`
+	RuntimeName     string `json:"runtime_name,omitempty"`
+	RuntimeVersion  string `json:"runtime_version,omitempty"`
+	SDKName         string `json:"sdk_name,omitempty"`
+	SDKLanguage     string `json:"sdk_language,omitempty"`
+	SDKVersion      string `json:"sdk_version,omitempty"`
+	DocCount        int64  `json:"doc_count"`
+}
+
+// TransactionGroup describes the transactions of a service
+// sharing the same name and type.
+type TransactionGroup struct {
+	Name                string        `json:"name"`
+	Type                string        `json:"type,omitempty"`
+	Count               int64         `json:"count"`
+	ThroughputPerMinute float64       `json:"throughput_per_minute"`
+	LatencyP50          time.Duration `json:"-"`
+	LatencyP95          time.Duration `json:"-"`
+	LatencyP99          time.Duration `json:"-"`
+	FailureRate         float64       `json:"failure_rate"`
+}
+
+// MarshalJSON encodes the transaction group with its latencies in
+// microseconds, the unit APM documents use for durations.
+func (g TransactionGroup) MarshalJSON() ([]byte, error) {
+	type transactionGroup TransactionGroup
+	return json.Marshal(struct {
+		transactionGroup
+		LatencyP50 int64 `json:"latency_p50_us"`
+		LatencyP95 int64 `json:"latency_p95_us"`
+		LatencyP99 int64 `json:"latency_p99_us"`
+	}{
+		transactionGroup: transactionGroup(g),
+		LatencyP50:       g.LatencyP50.Microseconds(),
+		LatencyP95:       g.LatencyP95.Microseconds(),
+		LatencyP99:       g.LatencyP99.Microseconds(),
+	})
+}
+
+// ServiceInstance describes an instance of a service, identified
+// by its service node name, host name, and container ID.
+type ServiceInstance struct {
+	NodeName            string    `json:"node_name,omitempty"`
+	HostName            string    `json:"host_name,omitempty"`
+	ContainerID         string    `json:"container_id,omitempty"`
+	LastSeen            time.Time `json:"last_seen"`
+	Count               int64     `json:"count"`
+	ThroughputPerMinute float64   `json:"throughput_per_minute"`
+}
+
+// ServiceMetrics describes the transaction throughput,
+// latency and failure rate of a service.
+type ServiceMetrics struct {
+	Name                string        `json:"name"`
+	Count               int64         `json:"count"`
+	ThroughputPerMinute float64       `json:"throughput_per_minute"`
+	LatencyP50          time.Duration `json:"-"`
+	LatencyP95          time.Duration `json:"-"`
+	LatencyP99          time.Duration `json:"-"`
+	FailureRate         float64       `json:"failure_rate"`
+	Instances           int64         `json:"instances"`
+}
+
+// MarshalJSON encodes the service metrics with latencies in microseconds.
+func (m ServiceMetrics) MarshalJSON() ([]byte, error) {
+	type serviceMetrics ServiceMetrics
+	return json.Marshal(struct {
+		serviceMetrics
+		LatencyP50 int64 `json:"latency_p50_us"`
+		LatencyP95 int64 `json:"latency_p95_us"`
+		LatencyP99 int64 `json:"latency_p99_us"`
+	}{
+		serviceMetrics: serviceMetrics(m),
+		LatencyP50:     m.LatencyP50.Microseconds(),
+		LatencyP95:     m.LatencyP95.Microseconds(),
+		LatencyP99:     m.LatencyP99.Microseconds(),
+	})
+}
+
+// ServiceDependency describes the outgoing requests
+// of a service to a destination resource.
+type ServiceDependency struct {
+	Resource            string        `json:"resource"`
+	Count               int64         `json:"count"`
+	ThroughputPerMinute float64       `json:"throughput_per_minute"`
+	LatencyAvg          time.Duration `json:"-"`
+	FailureRate         float64       `json:"failure_rate"`
+}
+
+// MarshalJSON encodes the dependency with its latency in microseconds.
+func (d ServiceDependency) MarshalJSON() ([]byte, error) {
+	type serviceDependency ServiceDependency
+	return json.Marshal(struct {
+		serviceDependency
+		LatencyAvg int64 `json:"latency_avg_us"`
+	}{
+		serviceDependency: serviceDependency(d),
+		LatencyAvg:        d.LatencyAvg.Microseconds(),
+	})
+}
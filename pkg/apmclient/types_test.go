@@ -0,0 +1,67 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmclient
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionGroupMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(TransactionGroup{
+		Name:                "GET /",
+		Type:                "request",
+		Count:               10,
+		ThroughputPerMinute: 2.5,
+		LatencyP50:          1500 * time.Microsecond,
+		LatencyP95:          20 * time.Millisecond,
+		LatencyP99:          time.Second,
+		FailureRate:         0.1,
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"name": "GET /",
+		"type": "request",
+		"count": 10,
+		"throughput_per_minute": 2.5,
+		"latency_p50_us": 1500,
+		"latency_p95_us": 20000,
+		"latency_p99_us": 1000000,
+		"failure_rate": 0.1
+	}`, string(data))
+}
+
+func TestServiceDependencyMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(ServiceDependency{
+		Resource:   "postgresql",
+		Count:      3,
+		LatencyAvg: 2500 * time.Microsecond,
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"resource": "postgresql",
+		"count": 3,
+		"throughput_per_minute": 0,
+		"latency_avg_us": 2500,
+		"failure_rate": 0
+	}`, string(data))
+}
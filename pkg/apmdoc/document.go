@@ -0,0 +1,285 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmdoc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Document holds the fields common to all APM documents.
+type Document struct {
+	// Fields holds all of the document's fields.
+	Fields Fields
+
+	Timestamp time.Time
+
+	// Event holds the value of processor.event, e.g. "transaction".
+	Event   string
+	Outcome string
+
+	ServiceName        string
+	ServiceEnvironment string
+	ServiceVersion     string
+	ServiceNodeName    string
+
+	AgentName    string
+	AgentVersion string
+
+	TraceID string
+}
+
+// NewDocument returns a Document decoded from fields.
+// It is an error for @timestamp or processor.event to be missing.
+func NewDocument(fields Fields) (*Document, error) {
+	d := decoder{fields: fields}
+	doc := &Document{
+		Fields:             fields,
+		Timestamp:          d.time("@timestamp"),
+		Event:              d.requiredString("processor.event"),
+		Outcome:            d.string("event.outcome"),
+		ServiceName:        d.string("service.name"),
+		ServiceEnvironment: d.string("service.environment"),
+		ServiceVersion:     d.string("service.version"),
+		ServiceNodeName:    d.string("service.node.name"),
+		AgentName:          d.string("agent.name"),
+		AgentVersion:       d.string("agent.version"),
+		TraceID:            d.string("trace.id"),
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return doc, nil
+}
+
+// NewDocumentFromSource returns a Document decoded from a document _source.
+func NewDocumentFromSource(source []byte) (*Document, error) {
+	fields, err := FieldsFromSource(source)
+	if err != nil {
+		return nil, err
+	}
+	return NewDocument(fields)
+}
+
+// Transaction holds a transaction document.
+type Transaction struct {
+	*Document
+	ID       string
+	ParentID string
+	Name     string
+	Type     string
+	Result   string
+	Duration time.Duration
+	Sampled  bool
+}
+
+// TransactionDoc returns the document as a Transaction, or an error if
+// it is not a transaction or required fields are missing.
+func (doc *Document) TransactionDoc() (*Transaction, error) {
+	d, err := doc.decoder("transaction")
+	if err != nil {
+		return nil, err
+	}
+	tx := &Transaction{
+		Document: doc,
+		ID:       d.requiredString("transaction.id"),
+		ParentID: d.string("parent.id"),
+		Name:     d.string("transaction.name"),
+		Type:     d.string("transaction.type"),
+		Result:   d.string("transaction.result"),
+		Duration: d.duration("transaction.duration.us"),
+		Sampled:  d.bool("transaction.sampled"),
+	}
+	return tx, d.err
+}
+
+// Span holds a span document.
+type Span struct {
+	*Document
+	ID                  string
+	ParentID            string
+	TransactionID       string
+	Name                string
+	Type                string
+	Subtype             string
+	Action              string
+	Duration            time.Duration
+	DestinationResource string
+}
+
+// SpanDoc returns the document as a Span, or an error if
+// it is not a span or required fields are missing.
+func (doc *Document) SpanDoc() (*Span, error) {
+	d, err := doc.decoder("span")
+	if err != nil {
+		return nil, err
+	}
+	span := &Span{
+		Document:            doc,
+		ID:                  d.requiredString("span.id"),
+		ParentID:            d.string("parent.id"),
+		TransactionID:       d.string("transaction.id"),
+		Name:                d.string("span.name"),
+		Type:                d.string("span.type"),
+		Subtype:             d.string("span.subtype"),
+		Action:              d.string("span.action"),
+		Duration:            d.duration("span.duration.us"),
+		DestinationResource: d.string("span.destination.service.resource"),
+	}
+	return span, d.err
+}
+
+// Error holds an error document.
+type Error struct {
+	*Document
+	ID               string
+	ParentID         string
+	TransactionID    string
+	GroupingKey      string
+	Culprit          string
+	ExceptionType    string
+	ExceptionMessage string
+	LogMessage       string
+}
+
+// ErrorDoc returns the document as an Error, or an error if
+// it is not an error or required fields are missing.
+func (doc *Document) ErrorDoc() (*Error, error) {
+	d, err := doc.decoder("error")
+	if err != nil {
+		return nil, err
+	}
+	e := &Error{
+		Document:         doc,
+		ID:               d.requiredString("error.id"),
+		ParentID:         d.string("parent.id"),
+		TransactionID:    d.string("transaction.id"),
+		GroupingKey:      d.string("error.grouping_key"),
+		Culprit:          d.string("error.culprit"),
+		ExceptionType:    d.string("error.exception.type"),
+		ExceptionMessage: d.string("error.exception.message"),
+		LogMessage:       d.string("error.log.message"),
+	}
+	return e, d.err
+}
+
+// Log holds a log document.
+type Log struct {
+	*Document
+	Message       string
+	Level         string
+	TransactionID string
+	SpanID        string
+}
+
+// LogDoc returns the document as a Log, or an error if it is not a log.
+func (doc *Document) LogDoc() (*Log, error) {
+	d, err := doc.decoder("log")
+	if err != nil {
+		return nil, err
+	}
+	log := &Log{
+		Document:      doc,
+		Message:       d.string("message"),
+		Level:         d.string("log.level"),
+		TransactionID: d.string("transaction.id"),
+		SpanID:        d.string("span.id"),
+	}
+	return log, d.err
+}
+
+// Metricset holds a metricset document.
+type Metricset struct {
+	*Document
+	Name     string
+	Interval string
+}
+
+// MetricsetDoc returns the document as a Metricset, or an error if
+// it is not a metricset or required fields are missing.
+//
+// Metric values may be accessed through the Fields getters.
+func (doc *Document) MetricsetDoc() (*Metricset, error) {
+	d, err := doc.decoder("metric")
+	if err != nil {
+		return nil, err
+	}
+	ms := &Metricset{
+		Document: doc,
+		Name:     d.requiredString("metricset.name"),
+		Interval: d.string("metricset.interval"),
+	}
+	return ms, d.err
+}
+
+// decoder returns a decoder for doc's fields, or an error
+// if doc's processor.event is not event.
+func (doc *Document) decoder(event string) (*decoder, error) {
+	if doc.Event != event {
+		return nil, fmt.Errorf("expected %s document, got %s", event, doc.Event)
+	}
+	return &decoder{fields: doc.Fields}, nil
+}
+
+// decoder decodes fields, recording the first error.
+// Optional fields which are missing are decoded as zero values.
+type decoder struct {
+	fields Fields
+	err    error
+}
+
+func (d *decoder) check(err error, required bool) {
+	if err == nil || d.err != nil {
+		return
+	}
+	if !required && errors.Is(err, ErrFieldMissing) {
+		return
+	}
+	d.err = err
+}
+
+func (d *decoder) string(name string) string {
+	v, err := d.fields.String(name)
+	d.check(err, false)
+	return v
+}
+
+func (d *decoder) requiredString(name string) string {
+	v, err := d.fields.String(name)
+	d.check(err, true)
+	return v
+}
+
+func (d *decoder) bool(name string) bool {
+	v, err := d.fields.Bool(name)
+	d.check(err, false)
+	return v
+}
+
+func (d *decoder) time(name string) time.Time {
+	v, err := d.fields.Time(name)
+	d.check(err, true)
+	return v
+}
+
+func (d *decoder) duration(name string) time.Duration {
+	v, err := d.fields.Duration(name)
+	d.check(err, false)
+	return v
+}
@@ -0,0 +1,71 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmdoc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-tools/pkg/apmdoc"
+)
+
+func TestTransactionFromSource(t *testing.T) {
+	doc, err := apmdoc.NewDocumentFromSource([]byte(`{
+		"@timestamp": "2024-01-02T03:04:05.123Z",
+		"processor": {"event": "transaction"},
+		"service": {"name": "opbeans"},
+		"trace": {"id": "abc"},
+		"transaction": {"id": "def", "name": "GET /", "duration": {"us": 1500}, "sampled": true}
+	}`))
+	require.NoError(t, err)
+	tx, err := doc.TransactionDoc()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 123e6, time.UTC), tx.Timestamp)
+	assert.Equal(t, "opbeans", tx.ServiceName)
+	assert.Equal(t, "abc", tx.TraceID)
+	assert.Equal(t, "def", tx.ID)
+	assert.Equal(t, "GET /", tx.Name)
+	assert.Equal(t, 1500*time.Microsecond, tx.Duration)
+	assert.True(t, tx.Sampled)
+
+	_, err = doc.SpanDoc()
+	assert.EqualError(t, err, "expected span document, got transaction")
+}
+
+func TestSpanFromFields(t *testing.T) {
+	doc, err := apmdoc.NewDocument(apmdoc.Fields{
+		"@timestamp":       {"2024-01-02T03:04:05Z"},
+		"processor.event":  {"span"},
+		"span.name":        {"SELECT"},
+		"span.duration.us": {float64(250)},
+	})
+	require.NoError(t, err)
+	_, err = doc.SpanDoc()
+	assert.ErrorIs(t, err, apmdoc.ErrFieldMissing)
+	assert.EqualError(t, err, `field "span.id" missing`)
+}
+
+func TestFieldsTypeError(t *testing.T) {
+	fields := apmdoc.Fields{"http.response.status_code": {"200"}}
+	_, err := fields.Int("http.response.status_code")
+	assert.ErrorIs(t, err, apmdoc.ErrFieldType)
+	assert.EqualError(t, err, `field "http.response.status_code": unexpected field type: expected integer: 200 (string)`)
+}
@@ -0,0 +1,210 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmdoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrFieldMissing is returned by Fields getters
+	// when a field does not exist.
+	ErrFieldMissing = errors.New("field missing")
+
+	// ErrFieldType is returned by Fields getters when
+	// a field's value does not have the expected type.
+	ErrFieldType = errors.New("unexpected field type")
+)
+
+// FieldError describes an error getting the value of a field.
+type FieldError struct {
+	Field string
+	Err   error
+
+	// Value holds the field's value, if it exists.
+	Value any
+}
+
+func (e *FieldError) Error() string {
+	switch {
+	case errors.Is(e.Err, ErrFieldMissing):
+		return fmt.Sprintf("field %q missing", e.Field)
+	case e.Value == nil:
+		return fmt.Sprintf("field %q: %s", e.Field, e.Err)
+	}
+	return fmt.Sprintf("field %q: %s: %v (%T)", e.Field, e.Err, e.Value, e.Value)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Fields holds the values of a document's fields, keyed by their
+// dotted names, as returned by the search API's "fields" option.
+type Fields map[string][]any
+
+// FieldsFromSource returns the flattened Fields of a document _source.
+func FieldsFromSource(source []byte) (Fields, error) {
+	dec := json.NewDecoder(bytes.NewReader(source))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("error decoding source: %w", err)
+	}
+	fields := make(Fields)
+	flatten("", m, fields)
+	return fields, nil
+}
+
+func flatten(prefix string, v any, out Fields) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, v := range v {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			flatten(k, v, out)
+		}
+	case []any:
+		for _, v := range v {
+			flatten(prefix, v, out)
+		}
+	case nil:
+	default:
+		out[prefix] = append(out[prefix], v)
+	}
+}
+
+// Has reports whether the named field has a value.
+func (f Fields) Has(name string) bool {
+	return len(f[name]) > 0
+}
+
+// Value returns the first value of the named field.
+func (f Fields) Value(name string) (any, error) {
+	values := f[name]
+	if len(values) == 0 {
+		return nil, &FieldError{Field: name, Err: ErrFieldMissing}
+	}
+	return values[0], nil
+}
+
+// String returns the first value of the named field as a string.
+func (f Fields) String(name string) (string, error) {
+	v, err := f.Value(name)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", &FieldError{Field: name, Err: fmt.Errorf("%w: expected string", ErrFieldType), Value: v}
+	}
+	return s, nil
+}
+
+// Int returns the first value of the named field as an integer.
+func (f Fields) Int(name string) (int64, error) {
+	v, err := f.Value(name)
+	if err != nil {
+		return 0, err
+	}
+	switch n := v.(type) {
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+	case float64:
+		if n == math.Trunc(n) {
+			return int64(n), nil
+		}
+	}
+	return 0, &FieldError{Field: name, Err: fmt.Errorf("%w: expected integer", ErrFieldType), Value: v}
+}
+
+// Float returns the first value of the named field as a float.
+func (f Fields) Float(name string) (float64, error) {
+	v, err := f.Value(name)
+	if err != nil {
+		return 0, err
+	}
+	switch n := v.(type) {
+	case json.Number:
+		if f, err := n.Float64(); err == nil {
+			return f, nil
+		}
+	case float64:
+		return n, nil
+	}
+	return 0, &FieldError{Field: name, Err: fmt.Errorf("%w: expected number", ErrFieldType), Value: v}
+}
+
+// Bool returns the first value of the named field as a boolean.
+func (f Fields) Bool(name string) (bool, error) {
+	v, err := f.Value(name)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, &FieldError{Field: name, Err: fmt.Errorf("%w: expected boolean", ErrFieldType), Value: v}
+	}
+	return b, nil
+}
+
+// Time returns the first value of the named field as a time.
+// The value must be an RFC 3339 formatted string.
+func (f Fields) Time(name string) (time.Time, error) {
+	s, err := f.String(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, &FieldError{Field: name, Err: fmt.Errorf("%w: %w", ErrFieldType, err), Value: s}
+	}
+	return t, nil
+}
+
+// durationUnits maps field name suffixes to units
+// of duration fields, such as transaction.duration.us.
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+}
+
+// Duration returns the first value of the named field as a duration.
+// The unit is determined by the field name's suffix, which must be
+// one of "ns", "us", or "ms".
+func (f Fields) Duration(name string) (time.Duration, error) {
+	unit, ok := durationUnits[name[strings.LastIndexByte(name, '.')+1:]]
+	if !ok {
+		return 0, &FieldError{Field: name, Err: errors.New("unknown duration unit")}
+	}
+	n, err := f.Float(name)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(n * float64(unit)), nil
+}
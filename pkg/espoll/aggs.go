@@ -0,0 +1,395 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// TermsAggregation groups documents into buckets by the values of a field.
+type TermsAggregation struct {
+	Field        string
+	Size         int
+	MinDocCount  *int
+	Missing      any
+	Aggregations map[string]any
+}
+
+// NewTermsAggregation returns a TermsAggregation for field.
+func NewTermsAggregation(field string) TermsAggregation {
+	return TermsAggregation{Field: field}
+}
+
+func (a TermsAggregation) WithSize(size int) TermsAggregation     { a.Size = size; return a }
+func (a TermsAggregation) WithMinDocCount(n int) TermsAggregation { a.MinDocCount = &n; return a }
+func (a TermsAggregation) WithMissing(v any) TermsAggregation     { a.Missing = v; return a }
+
+// WithAggregation returns a copy of a with the named sub-aggregation added.
+func (a TermsAggregation) WithAggregation(name string, agg any) TermsAggregation {
+	a.Aggregations = withAggregation(a.Aggregations, name, agg)
+	return a
+}
+
+func (a TermsAggregation) MarshalJSON() ([]byte, error) {
+	type termsAggregation struct {
+		Field       string `json:"field"`
+		Size        int    `json:"size,omitempty"`
+		MinDocCount *int   `json:"min_doc_count,omitempty"`
+		Missing     any    `json:"missing,omitempty"`
+	}
+	return encodeAggregationJSON("terms", termsAggregation{
+		a.Field, a.Size, a.MinDocCount, a.Missing,
+	}, a.Aggregations)
+}
+
+// DateHistogramAggregation groups documents into buckets by date.
+//
+// Exactly one of FixedInterval or CalendarInterval should be set.
+type DateHistogramAggregation struct {
+	Field            string
+	FixedInterval    string
+	CalendarInterval string
+	MinDocCount      *int
+	Format           string
+	TimeZone         string
+	Aggregations     map[string]any
+}
+
+// NewDateHistogramAggregation returns a DateHistogramAggregation for field,
+// with buckets of a fixed interval, e.g. "1m".
+func NewDateHistogramAggregation(field, fixedInterval string) DateHistogramAggregation {
+	return DateHistogramAggregation{Field: field, FixedInterval: fixedInterval}
+}
+
+func (a DateHistogramAggregation) WithMinDocCount(n int) DateHistogramAggregation {
+	a.MinDocCount = &n
+	return a
+}
+
+func (a DateHistogramAggregation) WithFormat(f string) DateHistogramAggregation {
+	a.Format = f
+	return a
+}
+
+func (a DateHistogramAggregation) WithTimeZone(tz string) DateHistogramAggregation {
+	a.TimeZone = tz
+	return a
+}
+
+// WithAggregation returns a copy of a with the named sub-aggregation added.
+func (a DateHistogramAggregation) WithAggregation(name string, agg any) DateHistogramAggregation {
+	a.Aggregations = withAggregation(a.Aggregations, name, agg)
+	return a
+}
+
+func (a DateHistogramAggregation) MarshalJSON() ([]byte, error) {
+	type dateHistogramAggregation struct {
+		Field            string `json:"field"`
+		FixedInterval    string `json:"fixed_interval,omitempty"`
+		CalendarInterval string `json:"calendar_interval,omitempty"`
+		MinDocCount      *int   `json:"min_doc_count,omitempty"`
+		Format           string `json:"format,omitempty"`
+		TimeZone         string `json:"time_zone,omitempty"`
+	}
+	return encodeAggregationJSON("date_histogram", dateHistogramAggregation{
+		a.Field, a.FixedInterval, a.CalendarInterval, a.MinDocCount, a.Format, a.TimeZone,
+	}, a.Aggregations)
+}
+
+// FiltersAggregation groups documents into a bucket per named query.
+type FiltersAggregation struct {
+	Filters      map[string]any
+	Aggregations map[string]any
+}
+
+// NewFiltersAggregation returns an empty FiltersAggregation.
+func NewFiltersAggregation() FiltersAggregation {
+	return FiltersAggregation{}
+}
+
+// WithFilter returns a copy of a with a bucket added for documents matching query.
+func (a FiltersAggregation) WithFilter(name string, query any) FiltersAggregation {
+	a.Filters = withAggregation(a.Filters, name, query)
+	return a
+}
+
+// WithAggregation returns a copy of a with the named sub-aggregation added.
+func (a FiltersAggregation) WithAggregation(name string, agg any) FiltersAggregation {
+	a.Aggregations = withAggregation(a.Aggregations, name, agg)
+	return a
+}
+
+func (a FiltersAggregation) MarshalJSON() ([]byte, error) {
+	return encodeAggregationJSON("filters", map[string]any{
+		"filters": a.Filters,
+	}, a.Aggregations)
+}
+
+// PercentilesAggregation calculates percentiles of a numeric or histogram field.
+type PercentilesAggregation struct {
+	Field    string
+	Percents []float64
+}
+
+func (a PercentilesAggregation) MarshalJSON() ([]byte, error) {
+	type percentilesAggregation struct {
+		Field    string    `json:"field"`
+		Percents []float64 `json:"percents,omitempty"`
+	}
+	return encodeAggregationJSON("percentiles", percentilesAggregation(a), nil)
+}
+
+// SumAggregation sums the values of a numeric field.
+type SumAggregation struct {
+	Field string
+}
+
+func (a SumAggregation) MarshalJSON() ([]byte, error) {
+	return encodeAggregationJSON("sum", map[string]any{"field": a.Field}, nil)
+}
+
+// AvgAggregation averages the values of a numeric field.
+type AvgAggregation struct {
+	Field string
+}
+
+func (a AvgAggregation) MarshalJSON() ([]byte, error) {
+	return encodeAggregationJSON("avg", map[string]any{"field": a.Field}, nil)
+}
+
+// ValueCountAggregation counts the values of a field.
+type ValueCountAggregation struct {
+	Field string
+}
+
+func (a ValueCountAggregation) MarshalJSON() ([]byte, error) {
+	return encodeAggregationJSON("value_count", map[string]any{"field": a.Field}, nil)
+}
+
+func withAggregation(m map[string]any, name string, agg any) map[string]any {
+	out := make(map[string]any, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	out[name] = agg
+	return out
+}
+
+func encodeAggregationJSON(k string, v any, aggs map[string]any) ([]byte, error) {
+	m := map[string]any{k: v}
+	if len(aggs) > 0 {
+		m["aggs"] = aggs
+	}
+	return json.Marshal(m)
+}
+
+// Aggregations holds named aggregation results, as found in a search
+// response or in a bucket of a multi-bucket aggregation.
+type Aggregations map[string]json.RawMessage
+
+// Bucket holds a bucket of a multi-bucket aggregation result.
+type Bucket struct {
+	// Key holds the bucket key. For filters aggregations,
+	// this is the name of the filter.
+	Key         any
+	KeyAsString string
+	DocCount    int64
+
+	// Aggregations holds the results of any sub-aggregations.
+	Aggregations Aggregations
+}
+
+func (b *Bucket) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	b.Aggregations = make(Aggregations)
+	for k, v := range fields {
+		var err error
+		switch k {
+		case "key":
+			err = json.Unmarshal(v, &b.Key)
+		case "key_as_string":
+			err = json.Unmarshal(v, &b.KeyAsString)
+		case "doc_count":
+			err = json.Unmarshal(v, &b.DocCount)
+		case "doc_count_error_upper_bound", "from", "to", "from_as_string", "to_as_string":
+		default:
+			b.Aggregations[k] = v
+		}
+		if err != nil {
+			return fmt.Errorf("error unmarshaling bucket %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+func (a Aggregations) get(name string) (json.RawMessage, error) {
+	raw, ok := a[name]
+	if !ok {
+		return nil, fmt.Errorf("aggregation %q not found", name)
+	}
+	return raw, nil
+}
+
+// Buckets decodes the buckets of the named multi-bucket aggregation,
+// such as terms, date_histogram, or filters.
+//
+// Keyed buckets are returned ordered by key.
+func (a Aggregations) Buckets(name string) ([]Bucket, error) {
+	raw, err := a.get(name)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Buckets json.RawMessage `json:"buckets"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("error unmarshaling aggregation %q: %w", name, err)
+	}
+	if len(result.Buckets) == 0 {
+		return nil, fmt.Errorf("aggregation %q has no buckets", name)
+	}
+	if result.Buckets[0] == '{' {
+		var keyed map[string]Bucket
+		if err := json.Unmarshal(result.Buckets, &keyed); err != nil {
+			return nil, fmt.Errorf("error unmarshaling aggregation %q buckets: %w", name, err)
+		}
+		buckets := make([]Bucket, 0, len(keyed))
+		for key, bucket := range keyed {
+			bucket.Key = key
+			buckets = append(buckets, bucket)
+		}
+		sort.Slice(buckets, func(i, j int) bool {
+			return buckets[i].Key.(string) < buckets[j].Key.(string)
+		})
+		return buckets, nil
+	}
+	var buckets []Bucket
+	if err := json.Unmarshal(result.Buckets, &buckets); err != nil {
+		return nil, fmt.Errorf("error unmarshaling aggregation %q buckets: %w", name, err)
+	}
+	return buckets, nil
+}
+
+// Value decodes the value of the named single-value metric aggregation,
+// such as sum, avg, or value_count.
+//
+// If the aggregation has no value, e.g. the average of no documents,
+// Value returns an error.
+func (a Aggregations) Value(name string) (float64, error) {
+	raw, err := a.get(name)
+	if err != nil {
+		return 0, err
+	}
+	var result struct {
+		Value *float64 `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return 0, fmt.Errorf("error unmarshaling aggregation %q: %w", name, err)
+	}
+	if result.Value == nil {
+		return 0, fmt.Errorf("aggregation %q has no value", name)
+	}
+	return *result.Value, nil
+}
+
+// Percentiles decodes the named percentiles aggregation, returning
+// a map of percent to value. Percentiles with no value are omitted.
+func (a Aggregations) Percentiles(name string) (map[float64]float64, error) {
+	raw, err := a.get(name)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Values json.RawMessage `json:"values"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("error unmarshaling aggregation %q: %w", name, err)
+	}
+	out := make(map[float64]float64)
+	if len(result.Values) > 0 && result.Values[0] == '[' {
+		var items []struct {
+			Key   float64  `json:"key"`
+			Value *float64 `json:"value"`
+		}
+		if err := json.Unmarshal(result.Values, &items); err != nil {
+			return nil, fmt.Errorf("error unmarshaling aggregation %q values: %w", name, err)
+		}
+		for _, item := range items {
+			if item.Value != nil {
+				out[item.Key] = *item.Value
+			}
+		}
+		return out, nil
+	}
+	var keyed map[string]json.RawMessage
+	if err := json.Unmarshal(result.Values, &keyed); err != nil {
+		return nil, fmt.Errorf("error unmarshaling aggregation %q values: %w", name, err)
+	}
+	for k, v := range keyed {
+		percent, err := strconv.ParseFloat(k, 64)
+		if err != nil {
+			// Skip *_as_string entries.
+			continue
+		}
+		var value *float64
+		if err := json.Unmarshal(v, &value); err != nil {
+			return nil, fmt.Errorf("error unmarshaling aggregation %q value %s: %w", name, k, err)
+		}
+		if value != nil {
+			out[percent] = *value
+		}
+	}
+	return out, nil
+}
+
+// AggregationsCondition returns a ConditionFunc which will return true
+// if f returns true for r.Aggregations. Errors decoding aggregations
+// are treated as the condition not being met.
+func (r *SearchResult) AggregationsCondition(f func(Aggregations) (bool, error)) ConditionFunc {
+	return func(*esapi.Response) bool {
+		ok, err := f(r.Aggregations)
+		return err == nil && ok
+	}
+}
+
+// MinBucketsCondition returns a ConditionFunc which will return true if the
+// named multi-bucket aggregation in r has at least min buckets.
+func (r *SearchResult) MinBucketsCondition(name string, min int) ConditionFunc {
+	return r.AggregationsCondition(func(a Aggregations) (bool, error) {
+		buckets, err := a.Buckets(name)
+		return len(buckets) >= min, err
+	})
+}
+
+// MinValueCondition returns a ConditionFunc which will return true if the
+// value of the named single-value metric aggregation in r, such as sum,
+// is at least min.
+func (r *SearchResult) MinValueCondition(name string, min float64) ConditionFunc {
+	return r.AggregationsCondition(func(a Aggregations) (bool, error) {
+		value, err := a.Value(name)
+		return value >= min, err
+	})
+}
@@ -0,0 +1,89 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+func TestAggregationJSON(t *testing.T) {
+	agg := espoll.NewTermsAggregation("service.name").
+		WithSize(5).
+		WithAggregation("duration", espoll.SumAggregation{Field: "transaction.duration.us"}).
+		WithAggregation("over_time", espoll.NewDateHistogramAggregation("@timestamp", "1m").WithMinDocCount(0))
+	data, err := json.Marshal(agg)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"terms": {"field": "service.name", "size": 5},
+		"aggs": {
+			"duration": {"sum": {"field": "transaction.duration.us"}},
+			"over_time": {"date_histogram": {"field": "@timestamp", "fixed_interval": "1m", "min_doc_count": 0}}
+		}
+	}`, string(data))
+}
+
+func TestAggregationsDecode(t *testing.T) {
+	var result espoll.SearchResult
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"hits": {"total": {"value": 3, "relation": "eq"}, "hits": []},
+		"aggregations": {
+			"services": {"buckets": [
+				{"key": "a", "doc_count": 2, "duration": {"value": 30}},
+				{"key": "b", "doc_count": 1, "duration": {"value": 5}}
+			]},
+			"outcomes": {"buckets": {
+				"success": {"doc_count": 2},
+				"failure": {"doc_count": 1}
+			}},
+			"latency": {"values": {"50.0": 10, "99.0": 20, "99.0_as_string": "20"}},
+			"empty_avg": {"value": null}
+		}
+	}`), &result))
+
+	services, err := result.Aggregations.Buckets("services")
+	require.NoError(t, err)
+	require.Len(t, services, 2)
+	assert.Equal(t, "a", services[0].Key)
+	assert.Equal(t, int64(2), services[0].DocCount)
+	duration, err := services[0].Aggregations.Value("duration")
+	require.NoError(t, err)
+	assert.Equal(t, 30.0, duration)
+
+	outcomes, err := result.Aggregations.Buckets("outcomes")
+	require.NoError(t, err)
+	require.Len(t, outcomes, 2)
+	assert.Equal(t, "failure", outcomes[0].Key)
+	assert.Equal(t, int64(1), outcomes[0].DocCount)
+
+	percentiles, err := result.Aggregations.Percentiles("latency")
+	require.NoError(t, err)
+	assert.Equal(t, map[float64]float64{50: 10, 99: 20}, percentiles)
+
+	_, err = result.Aggregations.Value("empty_avg")
+	assert.EqualError(t, err, `aggregation "empty_avg" has no value`)
+
+	assert.True(t, result.MinBucketsCondition("services", 2)(nil))
+	assert.False(t, result.MinBucketsCondition("services", 3)(nil))
+	assert.False(t, result.MinValueCondition("empty_avg", 0)(nil))
+}
@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll
+
+import (
+	"github.com/elastic/apm-tools/pkg/apmdoc"
+)
+
+// DocumentFields returns the hit's fields for decoding with apmdoc.
+// The search "fields" are used if present, and otherwise the
+// fields are flattened from _source.
+func (h *SearchHit) DocumentFields() (apmdoc.Fields, error) {
+	if len(h.Fields) > 0 {
+		return apmdoc.Fields(h.Fields), nil
+	}
+	return apmdoc.FieldsFromSource(h.RawSource)
+}
+
+// Document decodes the hit as an APM document.
+func (h *SearchHit) Document() (*apmdoc.Document, error) {
+	fields, err := h.DocumentFields()
+	if err != nil {
+		return nil, err
+	}
+	return apmdoc.NewDocument(fields)
+}
+
+// TransactionDoc decodes the hit as a transaction document.
+func (h *SearchHit) TransactionDoc() (*apmdoc.Transaction, error) {
+	doc, err := h.Document()
+	if err != nil {
+		return nil, err
+	}
+	return doc.TransactionDoc()
+}
+
+// SpanDoc decodes the hit as a span document.
+func (h *SearchHit) SpanDoc() (*apmdoc.Span, error) {
+	doc, err := h.Document()
+	if err != nil {
+		return nil, err
+	}
+	return doc.SpanDoc()
+}
+
+// ErrorDoc decodes the hit as an error document.
+func (h *SearchHit) ErrorDoc() (*apmdoc.Error, error) {
+	doc, err := h.Document()
+	if err != nil {
+		return nil, err
+	}
+	return doc.ErrorDoc()
+}
+
+// LogDoc decodes the hit as a log document.
+func (h *SearchHit) LogDoc() (*apmdoc.Log, error) {
+	doc, err := h.Document()
+	if err != nil {
+		return nil, err
+	}
+	return doc.LogDoc()
+}
+
+// MetricsetDoc decodes the hit as a metricset document.
+func (h *SearchHit) MetricsetDoc() (*apmdoc.Metricset, error) {
+	doc, err := h.Document()
+	if err != nil {
+		return nil, err
+	}
+	return doc.MetricsetDoc()
+}
@@ -0,0 +1,59 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+func TestSearchHitErrorDoc(t *testing.T) {
+	for name, hitJSON := range map[string]string{
+		"source": `{"_index":"logs-apm.error-default","_id":"1","fields":{},"_source":{
+			"@timestamp": "2024-01-01T00:00:00.000Z",
+			"processor": {"event": "error"},
+			"service": {"name": "svc"},
+			"error": {"id": "abc", "exception": [{"message": "boom"}]}
+		}}`,
+		"fields": `{"_index":"logs-apm.error-default","_id":"1","_source":{},"fields":{
+			"@timestamp": ["2024-01-01T00:00:00.000Z"],
+			"processor.event": ["error"],
+			"service.name": ["svc"],
+			"error.id": ["abc"],
+			"error.exception.message": ["boom"]
+		}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var hit espoll.SearchHit
+			require.NoError(t, json.Unmarshal([]byte(hitJSON), &hit))
+			e, err := hit.ErrorDoc()
+			require.NoError(t, err)
+			assert.Equal(t, "abc", e.ID)
+			assert.Equal(t, "svc", e.ServiceName)
+			assert.Equal(t, "boom", e.ExceptionMessage)
+
+			_, err = hit.TransactionDoc()
+			assert.EqualError(t, err, "expected transaction document, got error")
+		})
+	}
+}
@@ -0,0 +1,507 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+const (
+	defaultBulkBatchSize = 500
+
+	// dynamicPlaceholder is the value substituted for dynamic
+	// fields in approvals files, see package approvaltest.
+	dynamicPlaceholder = "dynamic"
+)
+
+// ReadDocs reads APM documents from r, which may contain any of:
+//
+//   - an approvals file with an "events" array of document sources,
+//     as written by approvaltest.ApproveEvents;
+//   - a JSON array of documents, such as an approvals file with
+//     flattened fields written by approvaltest.ApproveFields;
+//   - newline-delimited JSON documents. Bulk API action lines,
+//     such as {"create":{}}, are skipped.
+func ReadDocs(r io.Reader) ([]map[string]any, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var docs []map[string]any
+	for {
+		var v any
+		if err := dec.Decode(&v); err == io.EOF {
+			return docs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("error decoding documents: %w", err)
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			if events, ok := v["events"].([]any); ok && len(v) == 1 {
+				if err := appendDocs(&docs, events); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if isBulkAction(v) {
+				continue
+			}
+			docs = append(docs, v)
+		case []any:
+			if err := appendDocs(&docs, v); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("expected JSON object or array, got %T", v)
+		}
+	}
+}
+
+func appendDocs(docs *[]map[string]any, values []any) error {
+	for _, v := range values {
+		doc, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("expected JSON object, got %T", v)
+		}
+		*docs = append(*docs, doc)
+	}
+	return nil
+}
+
+// isBulkAction reports whether v is a bulk API action line.
+func isBulkAction(v map[string]any) bool {
+	if len(v) != 1 {
+		return false
+	}
+	for k, v := range v {
+		_, isObject := v.(map[string]any)
+		return isObject && (k == "create" || k == "index")
+	}
+	return false
+}
+
+// IndexOption sets options for IndexDocs.
+type IndexOption func(*indexOptions)
+
+type indexOptions struct {
+	namespace string
+	batchSize int
+	progress  func(BulkIndexResult)
+}
+
+// WithNamespace sets the data stream namespace for indexed documents,
+// overriding any data_stream.namespace field in the documents.
+func WithNamespace(namespace string) IndexOption {
+	return func(opts *indexOptions) {
+		opts.namespace = namespace
+	}
+}
+
+// WithBatchSize sets the maximum number of documents
+// indexed by each bulk request. The default is 500.
+func WithBatchSize(n int) IndexOption {
+	return func(opts *indexOptions) {
+		opts.batchSize = n
+	}
+}
+
+// WithProgress sets a function to call with the
+// cumulative result after each bulk request.
+func WithProgress(f func(BulkIndexResult)) IndexOption {
+	return func(opts *indexOptions) {
+		opts.progress = f
+	}
+}
+
+// BulkIndexResult describes the outcome of IndexDocs.
+type BulkIndexResult struct {
+	// Total holds the total number of documents to index.
+	Total int
+
+	// Indexed holds the number of documents indexed successfully.
+	Indexed int
+
+	// Errors holds an error for each document that failed to index.
+	Errors []BulkItemError
+
+	// DataStreams holds the data streams written to.
+	DataStreams []string
+}
+
+// BulkItemError describes a document that failed to index.
+type BulkItemError struct {
+	// Doc holds the index of the document in the docs
+	// passed to IndexDocs.
+	Doc int
+
+	Index  string `json:"_index"`
+	Status int    `json:"status"`
+	Error  struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+func (e BulkItemError) String() string {
+	return fmt.Sprintf("document %d: %s: %s (%d): %s", e.Doc, e.Index, e.Error.Type, e.Status, e.Error.Reason)
+}
+
+// IndexDocs bulk-indexes APM documents into the data streams
+// identified by their data_stream.* fields, or if those are missing,
+// the APM data streams for their processor.event. Metric documents
+// are routed by their metricset.name and metricset.interval.
+//
+// Copies of the documents are indexed, modified as follows; docs
+// itself is left unchanged:
+//
+//   - Timestamps are rebased so that the latest @timestamp is now,
+//     preserving the time between documents. timestamp.us fields
+//     are adjusted likewise. Documents without a @timestamp are
+//     given the current time, in both fields.
+//   - Fields holding the approvals placeholder value "dynamic"
+//     are removed.
+//   - data_stream.* fields are replaced by a data_stream object
+//     matching the target data stream.
+//
+// The data streams are refreshed once all documents are indexed.
+// If any documents fail to index, IndexDocs returns an error
+// along with the result, whose Errors describe each failure.
+func (es *Client) IndexDocs(ctx context.Context, docs []map[string]any, opts ...IndexOption) (BulkIndexResult, error) {
+	options := indexOptions{batchSize: defaultBulkBatchSize}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.batchSize <= 0 {
+		options.batchSize = defaultBulkBatchSize
+	}
+
+	docs = copyDocs(docs)
+	result := BulkIndexResult{Total: len(docs)}
+	dataStreams := make([]string, len(docs))
+	for i, doc := range docs {
+		removeDynamicPlaceholders(doc)
+		dataStream, err := routeDataStream(doc, options.namespace)
+		if err != nil {
+			return result, fmt.Errorf("document %d: %w", i, err)
+		}
+		dataStreams[i] = dataStream
+		if !slices.Contains(result.DataStreams, dataStream) {
+			result.DataStreams = append(result.DataStreams, dataStream)
+		}
+	}
+	if err := rebaseTimestamps(docs, time.Now()); err != nil {
+		return result, err
+	}
+
+	var body bytes.Buffer
+	for start := 0; start < len(docs); start += options.batchSize {
+		end := min(start+options.batchSize, len(docs))
+		body.Reset()
+		enc := json.NewEncoder(&body)
+		for i := start; i < end; i++ {
+			action := map[string]any{"create": map[string]string{"_index": dataStreams[i]}}
+			if err := enc.Encode(action); err != nil {
+				return result, err
+			}
+			if err := enc.Encode(docs[i]); err != nil {
+				return result, fmt.Errorf("error encoding document %d: %w", i, err)
+			}
+		}
+		var response struct {
+			Items []map[string]BulkItemError `json:"items"`
+		}
+		req := esapi.BulkRequest{Body: bytes.NewReader(body.Bytes())}
+		if _, err := es.Do(ctx, &req, &response); err != nil {
+			return result, fmt.Errorf("bulk request failed: %w", err)
+		}
+		for i, item := range response.Items {
+			for _, itemResult := range item {
+				if itemResult.Status >= 200 && itemResult.Status < 300 {
+					result.Indexed++
+					continue
+				}
+				itemResult.Doc = start + i
+				result.Errors = append(result.Errors, itemResult)
+			}
+		}
+		if options.progress != nil {
+			options.progress(result)
+		}
+	}
+	if len(result.DataStreams) > 0 {
+		if err := es.refresh(ctx, strings.Join(result.DataStreams, ",")); err != nil {
+			return result, err
+		}
+	}
+	if n := len(result.Errors); n > 0 {
+		return result, fmt.Errorf("%d of %d documents failed to index, first error: %s", n, len(docs), result.Errors[0])
+	}
+	return result, nil
+}
+
+// processorEventDataStreams maps processor.event values to the
+// data stream type and dataset used when documents do not have
+// data_stream.* fields. Metric documents are handled by metricDataset.
+var processorEventDataStreams = map[string][2]string{
+	"transaction": {"traces", "apm"},
+	"span":        {"traces", "apm"},
+	"error":       {"logs", "apm.error"},
+	"log":         {"logs", "apm.app"},
+}
+
+// aggregatedMetricsets holds the names of metric sets aggregated by
+// APM Server, which are stored in a data stream per interval.
+var aggregatedMetricsets = []string{
+	"service_destination",
+	"service_summary",
+	"service_transaction",
+	"transaction",
+}
+
+// internalMetricsets holds the names of metric sets
+// stored in the metrics-apm.internal data stream.
+var internalMetricsets = []string{
+	"agent_config",
+	"span_breakdown",
+	"transaction_breakdown",
+}
+
+// metricDataset returns the data stream dataset for a metric document
+// without data_stream.* fields, as APM Server would route it.
+func metricDataset(doc map[string]any) (string, error) {
+	name, _ := docField(doc, "metricset.name").(string)
+	switch {
+	case name == "app":
+		service, _ := docField(doc, "service.name").(string)
+		if service == "" {
+			return "", errors.New("cannot determine data stream: app metrics missing service.name")
+		}
+		return "apm.app." + normalizeServiceName(service), nil
+	case slices.Contains(aggregatedMetricsets, name):
+		interval, _ := docField(doc, "metricset.interval").(string)
+		if interval == "" {
+			return "", fmt.Errorf("cannot determine data stream: %s metrics missing metricset.interval", name)
+		}
+		return fmt.Sprintf("apm.%s.%s", name, interval), nil
+	case slices.Contains(internalMetricsets, name):
+		return "apm.internal", nil
+	case name == "":
+		return "", errors.New("cannot determine data stream: metrics missing metricset.name")
+	}
+	return "", fmt.Errorf("cannot determine data stream: unknown metricset.name %q", name)
+}
+
+// normalizeServiceName returns service in the form
+// used in data stream names by APM Server.
+func normalizeServiceName(service string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\\', '/', '*', '?', '"', '<', '>', '|', ' ', ',', '#', ':', '-':
+			return '_'
+		}
+		return r
+	}, strings.ToLower(service))
+}
+
+// routeDataStream returns the data stream for doc, and replaces its
+// data_stream.* fields, whether stored with dotted keys or as a nested
+// object, with a single data_stream object to match.
+func routeDataStream(doc map[string]any, namespace string) (string, error) {
+	typ, _ := docField(doc, "data_stream.type").(string)
+	dataset, _ := docField(doc, "data_stream.dataset").(string)
+	if typ == "" || dataset == "" {
+		event, _ := docField(doc, "processor.event").(string)
+		if event == "metric" {
+			var err error
+			if dataset, err = metricDataset(doc); err != nil {
+				return "", err
+			}
+			typ = "metrics"
+		} else {
+			ds, ok := processorEventDataStreams[event]
+			if !ok {
+				return "", errors.New("cannot determine data stream: missing data_stream.type, data_stream.dataset and processor.event")
+			}
+			typ, dataset = ds[0], ds[1]
+		}
+	}
+	if namespace == "" {
+		namespace, _ = docField(doc, "data_stream.namespace").(string)
+		if namespace == "" {
+			namespace = "default"
+		}
+	}
+	for _, field := range []string{"type", "dataset", "namespace"} {
+		delete(doc, "data_stream."+field)
+	}
+	doc["data_stream"] = map[string]any{
+		"type":      typ,
+		"dataset":   dataset,
+		"namespace": namespace,
+	}
+	return fmt.Sprintf("%s-%s-%s", typ, dataset, namespace), nil
+}
+
+// rebaseTimestamps shifts the timestamps of docs so that the latest
+// @timestamp is now. Documents without a @timestamp are given now,
+// in both @timestamp and any timestamp.us field.
+func rebaseTimestamps(docs []map[string]any, now time.Time) error {
+	timestamps := make([]time.Time, len(docs))
+	var latest time.Time
+	for i, doc := range docs {
+		s, _ := docField(doc, "@timestamp").(string)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return fmt.Errorf("document %d: error parsing @timestamp: %w", i, err)
+		}
+		timestamps[i] = t
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	var offset time.Duration
+	if !latest.IsZero() {
+		offset = now.Sub(latest)
+	}
+	for i, doc := range docs {
+		t := now
+		if !timestamps[i].IsZero() {
+			t = timestamps[i].Add(offset)
+		}
+		setDocField(doc, "@timestamp", t.UTC().Format(time.RFC3339Nano))
+		us, ok := docField(doc, "timestamp.us").(json.Number)
+		if !ok {
+			continue
+		}
+		if timestamps[i].IsZero() {
+			setDocField(doc, "timestamp.us", t.UnixMicro())
+		} else if n, err := us.Int64(); err == nil && offset != 0 {
+			setDocField(doc, "timestamp.us", n+offset.Microseconds())
+		}
+	}
+	return nil
+}
+
+// copyDocs returns a deep copy of docs.
+func copyDocs(docs []map[string]any) []map[string]any {
+	out := make([]map[string]any, len(docs))
+	for i, doc := range docs {
+		out[i] = copyValue(doc).(map[string]any)
+	}
+	return out
+}
+
+func copyValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, v := range v {
+			out[k] = copyValue(v)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, v := range v {
+			out[i] = copyValue(v)
+		}
+		return out
+	}
+	return v
+}
+
+// removeDynamicPlaceholders removes fields holding the approvals
+// placeholder value from doc, along with any objects left empty.
+func removeDynamicPlaceholders(doc map[string]any) {
+	for k, v := range doc {
+		switch v := v.(type) {
+		case string:
+			if v == dynamicPlaceholder {
+				delete(doc, k)
+			}
+		case []any:
+			if len(v) == 1 && v[0] == dynamicPlaceholder {
+				delete(doc, k)
+			}
+		case map[string]any:
+			removeDynamicPlaceholders(v)
+			if len(v) == 0 {
+				delete(doc, k)
+			}
+		}
+	}
+}
+
+// docField returns the value of a field in doc, which may be stored
+// with a dotted key, or as nested objects. Single-valued arrays are
+// unwrapped, as in flattened fields.
+func docField(doc map[string]any, name string) any {
+	v, ok := doc[name]
+	if !ok {
+		head, tail, found := strings.Cut(name, ".")
+		if !found {
+			return nil
+		}
+		if nested, ok := doc[head].(map[string]any); ok {
+			return docField(nested, tail)
+		}
+		return nil
+	}
+	if values, ok := v.([]any); ok && len(values) == 1 {
+		return values[0]
+	}
+	return v
+}
+
+// setDocField sets the value of a field in doc. If the field exists
+// with a dotted key, or an object exists for a prefix of the field
+// name, then it is updated; otherwise a nested object is created.
+func setDocField(doc map[string]any, name string, value any) {
+	if v, ok := doc[name]; ok {
+		if _, isArray := v.([]any); isArray {
+			value = []any{value}
+		}
+		doc[name] = value
+		return
+	}
+	head, tail, found := strings.Cut(name, ".")
+	if !found {
+		doc[name] = value
+		return
+	}
+	nested, ok := doc[head].(map[string]any)
+	if !ok {
+		if _, exists := doc[head]; exists {
+			doc[name] = value
+			return
+		}
+		nested = make(map[string]any)
+		doc[head] = nested
+	}
+	setDocField(nested, tail, value)
+}
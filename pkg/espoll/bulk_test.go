@@ -0,0 +1,213 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+func TestReadDocs(t *testing.T) {
+	for name, input := range map[string]string{
+		"events": `{"events": [{"processor": {"event": "transaction"}}, {"processor": {"event": "span"}}]}`,
+		"fields": `[{"processor.event": ["transaction"]}, {"processor.event": ["span"]}]`,
+		"ndjson": `{"create": {}}
+{"processor": {"event": "transaction"}}
+{"create": {}}
+{"processor": {"event": "span"}}
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			docs, err := espoll.ReadDocs(strings.NewReader(input))
+			require.NoError(t, err)
+			assert.Len(t, docs, 2)
+		})
+	}
+}
+
+func TestIndexDocs(t *testing.T) {
+	const input = `{"events": [
+		{"@timestamp": "2020-01-01T00:00:00.000Z", "processor": {"event": "transaction"}, "timestamp": {"us": 1577836800000000}},
+		{"@timestamp": "2020-01-01T00:00:01.000Z", "processor": {"event": "error"}, "observer": {"id": "dynamic"}},
+		{"@timestamp": ["2020-01-01T00:00:02.000Z"], "data_stream.type": ["metrics"], "data_stream.dataset": ["apm.app.foo"]}
+	]}`
+	docs, err := espoll.ReadDocs(strings.NewReader(input))
+	require.NoError(t, err)
+	original, err := espoll.ReadDocs(strings.NewReader(input))
+	require.NoError(t, err)
+
+	var actions []string
+	var indexed []map[string]any
+	es := newTestClient(func(req *http.Request) (int, string) {
+		if req.URL.Path != "/_bulk" {
+			assert.Equal(t, "/traces-apm-test,logs-apm.error-test,metrics-apm.app.foo-test/_refresh", req.URL.Path)
+			return http.StatusOK, `{}`
+		}
+		scanner := bufio.NewScanner(req.Body)
+		for scanner.Scan() {
+			actions = append(actions, scanner.Text())
+			scanner.Scan()
+			var doc map[string]any
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &doc))
+			indexed = append(indexed, doc)
+		}
+		return http.StatusOK, `{"errors": true, "items": [
+			{"create": {"_index": "traces-apm-test", "status": 201}},
+			{"create": {"_index": "logs-apm.error-test", "status": 201}},
+			{"create": {"_index": "metrics-apm.app.foo-test", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "bad"}}}
+		]}`
+	})
+
+	before := time.Now()
+	var progress []espoll.BulkIndexResult
+	result, err := es.IndexDocs(context.Background(), docs,
+		espoll.WithNamespace("test"),
+		espoll.WithBatchSize(10),
+		espoll.WithProgress(func(r espoll.BulkIndexResult) { progress = append(progress, r) }),
+	)
+	assert.EqualError(t, err, "1 of 3 documents failed to index, first error: "+
+		"document 2: metrics-apm.app.foo-test: mapper_parsing_exception (400): bad")
+	assert.Equal(t, 3, result.Total)
+	assert.Equal(t, 2, result.Indexed)
+	assert.Len(t, progress, 1)
+	assert.Equal(t, []string{
+		`{"create":{"_index":"traces-apm-test"}}`,
+		`{"create":{"_index":"logs-apm.error-test"}}`,
+		`{"create":{"_index":"metrics-apm.app.foo-test"}}`,
+	}, actions)
+
+	require.Len(t, indexed, 3)
+	latest, err := time.Parse(time.RFC3339Nano, indexed[2]["@timestamp"].([]any)[0].(string))
+	require.NoError(t, err)
+	assert.False(t, latest.Before(before.Truncate(time.Microsecond)))
+	first, err := time.Parse(time.RFC3339Nano, indexed[0]["@timestamp"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, latest.Sub(first))
+	assert.Equal(t, float64(first.UnixMicro()), indexed[0]["timestamp"].(map[string]any)["us"])
+	assert.Equal(t, map[string]any{"type": "traces", "dataset": "apm", "namespace": "test"}, indexed[0]["data_stream"])
+	assert.NotContains(t, indexed[1], "observer")
+	assert.Equal(t, map[string]any{"type": "metrics", "dataset": "apm.app.foo", "namespace": "test"}, indexed[2]["data_stream"])
+	assert.NotContains(t, indexed[2], "data_stream.type")
+	assert.NotContains(t, indexed[2], "data_stream.dataset")
+
+	// The caller's documents are not modified.
+	assert.Equal(t, original, docs)
+}
+
+func TestIndexDocsMetricDataStreams(t *testing.T) {
+	var actions []string
+	es := newTestClient(func(req *http.Request) (int, string) {
+		if req.URL.Path != "/_bulk" {
+			return http.StatusOK, `{}`
+		}
+		scanner := bufio.NewScanner(req.Body)
+		for scanner.Scan() {
+			actions = append(actions, scanner.Text())
+			scanner.Scan()
+		}
+		return http.StatusOK, `{"errors": false, "items": []}`
+	})
+
+	docs, err := espoll.ReadDocs(strings.NewReader(`{"events": [
+		{"processor": {"event": "metric"}, "metricset": {"name": "app"}, "service": {"name": "My-Service"}},
+		{"processor": {"event": "metric"}, "metricset": {"name": "service_transaction", "interval": "10m"}},
+		{"processor": {"event": "metric"}, "metricset": {"name": "transaction", "interval": "1m"}},
+		{"processor": {"event": "metric"}, "metricset": {"name": "span_breakdown"}}
+	]}`))
+	require.NoError(t, err)
+	_, err = es.IndexDocs(context.Background(), docs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`{"create":{"_index":"metrics-apm.app.my_service-default"}}`,
+		`{"create":{"_index":"metrics-apm.service_transaction.10m-default"}}`,
+		`{"create":{"_index":"metrics-apm.transaction.1m-default"}}`,
+		`{"create":{"_index":"metrics-apm.internal-default"}}`,
+	}, actions)
+
+	for _, test := range []struct {
+		doc      string
+		expected string
+	}{{
+		doc:      `{"processor": {"event": "metric"}}`,
+		expected: "document 1: cannot determine data stream: metrics missing metricset.name",
+	}, {
+		doc:      `{"processor": {"event": "metric"}, "metricset": {"name": "app"}}`,
+		expected: "document 1: cannot determine data stream: app metrics missing service.name",
+	}, {
+		doc:      `{"processor": {"event": "metric"}, "metricset": {"name": "service_summary"}}`,
+		expected: "document 1: cannot determine data stream: service_summary metrics missing metricset.interval",
+	}, {
+		doc:      `{"processor": {"event": "metric"}, "metricset": {"name": "unknown"}}`,
+		expected: `document 1: cannot determine data stream: unknown metricset.name "unknown"`,
+	}} {
+		input := `[{"@timestamp": "2020-01-01T00:00:00.000Z", "processor": {"event": "transaction"}, "observer": {"id": "dynamic"}}, ` + test.doc + `]`
+		docs, err := espoll.ReadDocs(strings.NewReader(input))
+		require.NoError(t, err)
+		original, err := espoll.ReadDocs(strings.NewReader(input))
+		require.NoError(t, err)
+		_, err = es.IndexDocs(context.Background(), docs)
+		assert.EqualError(t, err, test.expected)
+		// Documents preceding the failure are not modified.
+		assert.Equal(t, original, docs)
+	}
+}
+
+func TestIndexDocsWithoutTimestamps(t *testing.T) {
+	docs, err := espoll.ReadDocs(strings.NewReader(`{"events": [
+		{"processor": {"event": "transaction"}, "timestamp": {"us": 1577836800000000}},
+		{"@timestamp": "2020-01-01T00:00:00.000Z", "processor": {"event": "span"}, "timestamp": {"us": 1577836800000000}}
+	]}`))
+	require.NoError(t, err)
+
+	var indexed []map[string]any
+	es := newTestClient(func(req *http.Request) (int, string) {
+		if req.URL.Path != "/_bulk" {
+			return http.StatusOK, `{}`
+		}
+		scanner := bufio.NewScanner(req.Body)
+		for scanner.Scan() {
+			scanner.Scan()
+			var doc map[string]any
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &doc))
+			indexed = append(indexed, doc)
+		}
+		return http.StatusOK, `{"errors": false, "items": [{"create": {"_index": "traces-apm-default", "status": 201}}]}`
+	})
+
+	before := time.Now()
+	_, err = es.IndexDocs(context.Background(), docs)
+	require.NoError(t, err)
+	require.Len(t, indexed, 2)
+
+	// Without a @timestamp, documents are given the
+	// current time in both @timestamp and timestamp.us.
+	timestamp, err := time.Parse(time.RFC3339Nano, indexed[0]["@timestamp"].(string))
+	require.NoError(t, err)
+	assert.False(t, timestamp.Before(before.Truncate(time.Microsecond)))
+	assert.Equal(t, float64(timestamp.UnixMicro()), indexed[0]["timestamp"].(map[string]any)["us"])
+}
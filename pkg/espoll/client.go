@@ -23,26 +23,104 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math/rand"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/elastic/apm-tools/pkg/apmclient"
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 )
 
-// Client wraps an Elasticsearch client
+// Client polls Elasticsearch for documents, sending requests through
+// a wrapped *elasticsearch.Client, *elasticsearch.TypedClient, or any
+// other esapi.Transport.
+//
+// The *elasticsearch.Client is embedded so that its APIs may be called
+// on the Client directly; it is nil if the Client wraps anything else.
 type Client struct {
 	*elasticsearch.Client
+
+	typed     *elasticsearch.TypedClient
+	transport esapi.Transport
+}
+
+// errNoTransport is returned for requests made with a Client
+// which wraps a nil client or transport.
+var errNoTransport = errors.New("espoll: Client has no Elasticsearch client or transport")
+
+// New returns an espoll.Client which sends requests using transport.
+//
+// The transport may be an Elasticsearch client, or a fake for testing.
+// Requests fail if transport is nil.
+func New(transport esapi.Transport) *Client {
+	switch t := transport.(type) {
+	case *elasticsearch.Client:
+		return WrapClient(t)
+	case *elasticsearch.TypedClient:
+		return WrapTypedClient(t)
+	}
+	return &Client{transport: transport}
+}
+
+// NewClient returns an espoll.Client connected to Elasticsearch using the
+// settings in cfg, so that it authenticates in the same way as apmclient.
+func NewClient(cfg apmclient.Config) (*Client, error) {
+	client, err := apmclient.NewElasticsearchClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return WrapClient(client), nil
+}
+
+// WrapClient wraps an Elasticsearch client and returns an espoll.Client.
+// Requests fail if c is nil.
+func WrapClient(c *elasticsearch.Client) *Client {
+	if c == nil {
+		return &Client{}
+	}
+	return &Client{Client: c, transport: c}
+}
+
+// WrapTypedClient wraps a typed Elasticsearch client and returns an
+// espoll.Client, sharing the typed client's connection. Requests fail
+// if c is nil.
+func WrapTypedClient(c *elasticsearch.TypedClient) *Client {
+	if c == nil {
+		return &Client{}
+	}
+	return &Client{typed: c, transport: c}
+}
+
+// TypedClient returns the wrapped *elasticsearch.TypedClient, or nil
+// if the Client wraps anything else.
+func (es *Client) TypedClient() *elasticsearch.TypedClient {
+	return es.typed
 }
 
-// WrapClient wraps an Elasticsearch client and returns an espoll.Client
-func WrapClient(c *elasticsearch.Client) *Client { return &Client{Client: c} }
+// Perform sends req using the wrapped client or transport,
+// implementing esapi.Transport.
+func (es *Client) Perform(req *http.Request) (*http.Response, error) {
+	if es.transport == nil {
+		return nil, errNoTransport
+	}
+	return es.transport.Perform(req)
+}
 
 type Request interface {
 	Do(ctx context.Context, transport esapi.Transport) (*esapi.Response, error)
 }
 
 // Do performs the specified request.
+//
+// If a condition has been specified with WithCondition, the request is
+// retried until the condition is met, the timeout is reached, the maximum
+// number of attempts have been made, or ctx is cancelled. In the latter
+// three cases a *PollError is returned, describing the last response.
 func (es *Client) Do(
 	ctx context.Context,
 	req Request,
@@ -59,7 +137,6 @@ func (es *Client) Do(
 	for _, opt := range opts {
 		opt(&requestOptions)
 	}
-	var timeoutC, tickerC <-chan time.Time
 	var transport esapi.Transport = es
 	if requestOptions.cond != nil {
 		// A return condition has been specified, which means we
@@ -67,51 +144,133 @@ func (es *Client) Do(
 		// bodyRepeater to ensure the body is copied as needed.
 		transport = &bodyRepeater{transport, nil}
 		if requestOptions.timeout > 0 {
-			timeout := time.NewTimer(requestOptions.timeout)
-			defer timeout.Stop()
-			timeoutC = timeout.C
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, requestOptions.timeout)
+			defer cancel()
 		}
 	}
 
-	var resp *esapi.Response
-	for {
-		if tickerC != nil {
+	start := time.Now()
+	var timer *time.Timer
+	var lastResp *esapi.Response
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			if requestOptions.maxAttempts > 0 && attempt > requestOptions.maxAttempts {
+				return nil, newPollError(ErrMaxAttempts, attempt-1, start, lastResp)
+			}
+			d := requestOptions.backoff(attempt - 1)
+			if timer == nil {
+				timer = time.NewTimer(d)
+				defer timer.Stop()
+			} else {
+				timer.Reset(d)
+			}
 			select {
-			case <-timeoutC:
-				return nil, context.DeadlineExceeded
-			case <-tickerC:
+			case <-ctx.Done():
+				return nil, newPollError(ctx.Err(), attempt-1, start, lastResp)
+			case <-timer.C:
 			}
 		}
-		var err error
-		resp, err = req.Do(ctx, transport)
+		resp, err := req.Do(ctx, transport)
 		if err != nil {
+			if ctx.Err() != nil && requestOptions.cond != nil {
+				return nil, newPollError(ctx.Err(), attempt, start, lastResp)
+			}
 			return nil, err
 		}
-		defer resp.Body.Close()
-		if resp.IsError() {
-			return nil, &Error{StatusCode: resp.StatusCode, Message: resp.String()}
-		}
 		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
 		if err != nil {
+			if ctx.Err() != nil && requestOptions.cond != nil {
+				return nil, newPollError(ctx.Err(), attempt, start, lastResp)
+			}
 			return nil, err
 		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if resp.IsError() {
+			return nil, &Error{StatusCode: resp.StatusCode, Message: resp.String()}
+		}
 		if out != nil {
 			if err := json.Unmarshal(body, out); err != nil {
 				return nil, err
 			}
 		}
-		resp.Body = io.NopCloser(bytes.NewReader(body))
 		if requestOptions.cond == nil || requestOptions.cond(resp) {
-			break
-		}
-		if tickerC == nil {
-			// First time around, start a ticker for retrying.
-			ticker := time.NewTicker(requestOptions.interval)
-			defer ticker.Stop()
-			tickerC = ticker.C
+			// The condition may have read the body; reset it.
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			return resp, nil
 		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		lastResp = resp
 	}
-	return resp, nil
+}
+
+// ErrMaxAttempts is returned, wrapped in a *PollError, when a request's
+// condition is not met within the number of attempts set by WithMaxAttempts.
+var ErrMaxAttempts = errors.New("maximum attempts reached")
+
+// PollError is returned by Client.Do when a request's condition
+// is not met before polling stops.
+type PollError struct {
+	// Err holds the reason polling stopped: context.DeadlineExceeded
+	// if the timeout was reached, context.Canceled if the context was
+	// cancelled, or ErrMaxAttempts.
+	Err error
+
+	// Attempts holds the number of requests made.
+	Attempts int
+
+	// Elapsed holds the time spent polling.
+	Elapsed time.Duration
+
+	// LastResponse holds the last response which did not meet the
+	// condition, or nil if no response was received. Its body may
+	// be read.
+	LastResponse *esapi.Response
+
+	lastBody []byte
+}
+
+func newPollError(err error, attempts int, start time.Time, lastResp *esapi.Response) *PollError {
+	pollErr := &PollError{
+		Err:          err,
+		Attempts:     attempts,
+		Elapsed:      time.Since(start),
+		LastResponse: lastResp,
+	}
+	if lastResp != nil {
+		pollErr.lastBody, _ = io.ReadAll(lastResp.Body)
+		lastResp.Body = io.NopCloser(bytes.NewReader(pollErr.lastBody))
+	}
+	return pollErr
+}
+
+// maxPollErrorBody is the maximum number of bytes of
+// the last response body included in PollError.Error.
+const maxPollErrorBody = 2048
+
+func (e *PollError) Error() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "condition not met after %d attempt", e.Attempts)
+	if e.Attempts != 1 {
+		buf.WriteString("s")
+	}
+	fmt.Fprintf(&buf, " in %s: %s", e.Elapsed.Round(time.Millisecond), e.Err)
+	if e.LastResponse == nil {
+		buf.WriteString(" (no response received)")
+		return buf.String()
+	}
+	fmt.Fprintf(&buf, "; last response: [%d %s] ", e.LastResponse.StatusCode, http.StatusText(e.LastResponse.StatusCode))
+	if len(e.lastBody) > maxPollErrorBody {
+		fmt.Fprintf(&buf, "%s... (%d bytes truncated)", e.lastBody[:maxPollErrorBody], len(e.lastBody)-maxPollErrorBody)
+	} else {
+		buf.Write(e.lastBody)
+	}
+	return buf.String()
+}
+
+func (e *PollError) Unwrap() error {
+	return e.Err
 }
 
 // RequestOption modifies certain parameters for an esapi.Request.
@@ -127,9 +286,28 @@ func (e *Error) Error() string {
 }
 
 type requestOptions struct {
-	timeout  time.Duration
-	interval time.Duration
-	cond     ConditionFunc
+	timeout     time.Duration
+	interval    time.Duration
+	maxInterval time.Duration
+	maxAttempts int
+	cond        ConditionFunc
+	diagnose    bool
+}
+
+// backoff returns the duration to wait after the given number of attempts.
+func (opts *requestOptions) backoff(attempts int) time.Duration {
+	if opts.maxInterval <= opts.interval {
+		return opts.interval
+	}
+	d := opts.maxInterval
+	if shift := attempts - 1; shift < 32 {
+		if exp := opts.interval << shift; exp > 0 && exp < d {
+			d = exp
+		}
+	}
+	// Add jitter so concurrent pollers don't synchronise,
+	// waiting somewhere between d/2 and d.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
 }
 
 // WithTimeout sets the timeout in an Elasticsearch request.
@@ -146,6 +324,22 @@ func WithInterval(d time.Duration) RequestOption {
 	}
 }
 
+// WithExponentialBackoff doubles the poll interval after each attempt,
+// up to max, adding random jitter to each interval.
+func WithExponentialBackoff(max time.Duration) RequestOption {
+	return func(opts *requestOptions) {
+		opts.maxInterval = max
+	}
+}
+
+// WithMaxAttempts limits the number of attempts made to satisfy the
+// request condition. Zero, the default, means no limit.
+func WithMaxAttempts(n int) RequestOption {
+	return func(opts *requestOptions) {
+		opts.maxAttempts = n
+	}
+}
+
 // ConditionFunc evaluates the esapi.Response.
 type ConditionFunc func(*esapi.Response) bool
 
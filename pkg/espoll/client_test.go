@@ -0,0 +1,231 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-tools/pkg/apmclient"
+	"github.com/elastic/apm-tools/pkg/espoll"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+type requestFunc func(ctx context.Context) (*esapi.Response, error)
+
+func (f requestFunc) Do(ctx context.Context, _ esapi.Transport) (*esapi.Response, error) {
+	return f(ctx)
+}
+
+func countingRequest(attempts *int) espoll.Request {
+	return requestFunc(func(context.Context) (*esapi.Response, error) {
+		*attempts++
+		return &esapi.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"hits":{"total":{"value":0}}}`)),
+		}, nil
+	})
+}
+
+func never(*esapi.Response) bool { return false }
+
+func TestDoMaxAttempts(t *testing.T) {
+	var attempts int
+	_, err := espoll.WrapClient(nil).Do(context.Background(), countingRequest(&attempts), nil,
+		espoll.WithCondition(never),
+		espoll.WithInterval(time.Millisecond),
+		espoll.WithMaxAttempts(3),
+	)
+	var pollErr *espoll.PollError
+	require.ErrorAs(t, err, &pollErr)
+	assert.ErrorIs(t, err, espoll.ErrMaxAttempts)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 3, pollErr.Attempts)
+	assert.Contains(t, err.Error(), `{"hits":{"total":{"value":0}}}`)
+}
+
+func TestDoTimeout(t *testing.T) {
+	var attempts int
+	_, err := espoll.WrapClient(nil).Do(context.Background(), countingRequest(&attempts), nil,
+		espoll.WithCondition(never),
+		espoll.WithInterval(time.Millisecond),
+		espoll.WithExponentialBackoff(10*time.Millisecond),
+		espoll.WithTimeout(50*time.Millisecond),
+	)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Greater(t, attempts, 1)
+}
+
+func TestDoContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var attempts int
+	errC := make(chan error, 1)
+	go func() {
+		_, err := espoll.WrapClient(nil).Do(ctx, countingRequest(&attempts), nil,
+			espoll.WithCondition(never),
+			espoll.WithInterval(time.Hour),
+		)
+		errC <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-errC:
+		assert.True(t, errors.Is(err, context.Canceled))
+	case <-time.After(5 * time.Second):
+		t.Fatal("Do did not return after context was cancelled")
+	}
+}
+
+// roundTripperFunc is an http.RoundTripper implemented by a function.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// searchRoundTripper responds to search requests with a single hit,
+// recording the request method and path.
+func searchRoundTripper(requests *[]string) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		*requests = append(*requests, req.Method+" "+req.URL.Path)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Content-Type":      []string{"application/json"},
+				"X-Elastic-Product": []string{"Elasticsearch"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"hits": {"total": {"value": 1, "relation": "eq"}, "hits": [
+				{"_index": "traces-apm-default", "_id": "abc", "_source": {}, "fields": {"service.name": ["svc"]}}
+			]}}`)),
+		}, nil
+	})
+}
+
+func TestNew(t *testing.T) {
+	es := newTestClient(func(req *http.Request) (int, string) {
+		return http.StatusOK, `{"count": 3}`
+	})
+	count, err := es.CountIndexMinDocs(context.Background(), 3, "traces-apm*", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Nil(t, es.Client)
+	assert.Nil(t, es.TypedClient())
+}
+
+func TestNilClient(t *testing.T) {
+	for name, es := range map[string]*espoll.Client{
+		"New":             espoll.New(nil),
+		"New_typed_nil":   espoll.New((*elasticsearch.Client)(nil)),
+		"WrapClient":      espoll.WrapClient(nil),
+		"WrapTypedClient": espoll.WrapTypedClient(nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, es.Client)
+			_, err := es.NewSearchRequest("traces-apm*").Do(context.Background(), nil)
+			assert.EqualError(t, err, "espoll: Client has no Elasticsearch client or transport")
+		})
+	}
+}
+
+func TestWrapClient(t *testing.T) {
+	var requests []string
+	client, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{"http://es:9200"},
+		Transport: searchRoundTripper(&requests),
+	})
+	require.NoError(t, err)
+
+	es := espoll.WrapClient(client)
+	assert.Same(t, client, es.Client)
+	assert.Nil(t, es.TypedClient())
+	assert.Same(t, client, espoll.New(client).Client)
+
+	var result espoll.SearchResult
+	_, err = es.NewSearchRequest("traces-apm*").Do(context.Background(), &result)
+	require.NoError(t, err)
+	require.Len(t, result.Hits.Hits, 1)
+
+	// The Elasticsearch client's APIs are promoted.
+	res, err := es.Search(es.Search.WithIndex("traces-apm*"))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, []string{"POST /traces-apm*/_search", "POST /traces-apm*/_search"}, requests)
+}
+
+func TestWrapTypedClient(t *testing.T) {
+	var requests []string
+	client, err := elasticsearch.NewTypedClient(elasticsearch.Config{
+		Addresses: []string{"http://es:9200"},
+		Transport: searchRoundTripper(&requests),
+	})
+	require.NoError(t, err)
+
+	es := espoll.WrapTypedClient(client)
+	assert.Same(t, client, es.TypedClient())
+	assert.Nil(t, es.Client)
+
+	// Requests made with espoll and the typed client share the transport.
+	var result espoll.SearchResult
+	_, err = es.NewSearchRequest("traces-apm*").
+		WithQuery(espoll.TermQuery{Field: "service.name", Value: "svc"}).
+		Do(context.Background(), &result)
+	require.NoError(t, err)
+	require.Len(t, result.Hits.Hits, 1)
+	assert.Equal(t, "abc", result.Hits.Hits[0].ID)
+	assert.Equal(t, []any{"svc"}, result.Hits.Hits[0].Fields["service.name"])
+
+	typedResult, err := client.Search().Index("traces-apm*").Do(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), typedResult.Hits.Total.Value)
+	assert.Equal(t, []string{"POST /traces-apm*/_search", "POST /traces-apm*/_search"}, requests)
+}
+
+func TestNewClient(t *testing.T) {
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"count": 2}`))
+	}))
+	defer srv.Close()
+
+	es, err := espoll.NewClient(apmclient.Config{
+		ElasticsearchURL: srv.URL,
+		APIKey:           "key",
+		MaxRetries:       -1,
+	})
+	require.NoError(t, err)
+	assert.NotNil(t, es.Client)
+
+	count, err := es.CountIndexMinDocs(context.Background(), 2, "traces-apm*", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, "APIKey key", authorization)
+}
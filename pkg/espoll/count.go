@@ -0,0 +1,176 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+)
+
+// CountIndexMinDocs counts documents in index matching query,
+// returning the count.
+//
+// Unlike SearchIndexMinDocs, no documents are returned. If the count
+// is less than min within the timeout, CountIndexMinDocs will return
+// an error.
+func (es *Client) CountIndexMinDocs(
+	ctx context.Context,
+	min int, index string,
+	query json.Marshaler,
+	opts ...RequestOption,
+) (int, error) {
+	var result CountResult
+	opts = append(opts, WithCondition(result.MinCountCondition(min)))
+	if err := es.countIndex(ctx, index, query, &result, opts...); err != nil {
+		return result.Count, es.diagnose(ctx, err, index, query, opts)
+	}
+	return result.Count, nil
+}
+
+// WaitIndexNoDocs waits until there are no documents in index matching
+// query, e.g. after deleting documents or data streams. Missing indices
+// are treated as having no documents.
+//
+// If documents still match after the timeout, WaitIndexNoDocs returns
+// an error along with the number of matching documents last counted.
+func (es *Client) WaitIndexNoDocs(
+	ctx context.Context,
+	index string,
+	query json.Marshaler,
+	opts ...RequestOption,
+) (int, error) {
+	var result CountResult
+	opts = append(opts, WithCondition(result.MaxCountCondition(0)))
+	if err := es.countIndex(ctx, index, query, &result, opts...); err != nil {
+		return result.Count, err
+	}
+	return result.Count, nil
+}
+
+// WaitIndexStableCount waits until the number of documents in index
+// matching query has remained unchanged for n consecutive counts after
+// the first, e.g. to detect that ingestion has finished, returning the
+// count. The interval between counts is set with WithInterval.
+func (es *Client) WaitIndexStableCount(
+	ctx context.Context,
+	n int, index string,
+	query json.Marshaler,
+	opts ...RequestOption,
+) (int, error) {
+	var result CountResult
+	opts = append(opts, WithCondition(result.StableCountCondition(n)))
+	if err := es.countIndex(ctx, index, query, &result, opts...); err != nil {
+		return result.Count, err
+	}
+	return result.Count, nil
+}
+
+func (es *Client) countIndex(
+	ctx context.Context,
+	index string,
+	query json.Marshaler,
+	result *CountResult,
+	opts ...RequestOption,
+) error {
+	req := es.NewCountRequest(index)
+	req.ExpandWildcards = "open,hidden"
+	ignoreUnavailable := true
+	req.IgnoreUnavailable = &ignoreUnavailable
+	if query != nil {
+		req = req.WithQuery(query)
+	}
+	if err := es.refresh(ctx, index); err != nil {
+		return err
+	}
+	if _, err := req.Do(ctx, result, opts...); err != nil {
+		return fmt.Errorf("failed issuing request: %w", err)
+	}
+	return nil
+}
+
+// NewCountRequest returns a count request using the wrapped Elasticsearch
+// client.
+func (es *Client) NewCountRequest(index string) *CountRequest {
+	req := &CountRequest{es: es}
+	req.Index = strings.Split(index, ",")
+	return req
+}
+
+// CountRequest wraps an esapi.CountRequest with a Client.
+type CountRequest struct {
+	esapi.CountRequest
+	es *Client
+}
+
+func (r *CountRequest) WithQuery(q any) *CountRequest {
+	var body struct {
+		Query any `json:"query"`
+	}
+	body.Query = q
+	r.Body = esutil.NewJSONReader(&body)
+	return r
+}
+
+func (r *CountRequest) Do(ctx context.Context, out *CountResult, opts ...RequestOption) (*esapi.Response, error) {
+	return r.es.Do(ctx, &r.CountRequest, out, opts...)
+}
+
+type CountResult struct {
+	Count int `json:"count"`
+}
+
+// MinCountCondition returns a ConditionFunc which will return true if r.Count
+// is at least min.
+func (r *CountResult) MinCountCondition(min int) ConditionFunc {
+	return func(*esapi.Response) bool { return r.Count >= min }
+}
+
+// MaxCountCondition returns a ConditionFunc which will return true if r.Count
+// is at most max.
+func (r *CountResult) MaxCountCondition(max int) ConditionFunc {
+	return func(*esapi.Response) bool { return r.Count <= max }
+}
+
+// ExactCountCondition returns a ConditionFunc which will return true if r.Count
+// is exactly n.
+func (r *CountResult) ExactCountCondition(n int) ConditionFunc {
+	return func(*esapi.Response) bool { return r.Count == n }
+}
+
+// StableCountCondition returns a ConditionFunc which will return true once
+// r.Count has remained unchanged for n consecutive evaluations after the
+// first, e.g. to detect that ingestion has finished. The interval between
+// evaluations is set with WithInterval.
+//
+// The returned ConditionFunc is stateful, and should not be reused.
+func (r *CountResult) StableCountCondition(n int) ConditionFunc {
+	last, unchanged := -1, 0
+	return func(*esapi.Response) bool {
+		if r.Count == last {
+			unchanged++
+		} else {
+			last, unchanged = r.Count, 0
+		}
+		return unchanged >= n
+	}
+}
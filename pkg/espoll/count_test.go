@@ -0,0 +1,140 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+func TestCountConditions(t *testing.T) {
+	var result espoll.CountResult
+	minCount := result.MinCountCondition(2)
+	maxCount := result.MaxCountCondition(2)
+	exactCount := result.ExactCountCondition(2)
+	for _, test := range []struct {
+		count             int
+		min, max, exactly bool
+	}{
+		{count: 0, max: true},
+		{count: 2, min: true, max: true, exactly: true},
+		{count: 3, min: true},
+	} {
+		result.Count = test.count
+		assert.Equal(t, test.min, minCount(nil), "min count=%d", test.count)
+		assert.Equal(t, test.max, maxCount(nil), "max count=%d", test.count)
+		assert.Equal(t, test.exactly, exactCount(nil), "exact count=%d", test.count)
+	}
+}
+
+func TestStableCountCondition(t *testing.T) {
+	var result espoll.CountResult
+	cond := result.StableCountCondition(2)
+	for i, test := range []struct {
+		count  int
+		stable bool
+	}{
+		{0, false},
+		{5, false},
+		{5, false},
+		{7, false}, // changed, start again
+		{7, false},
+		{7, true},
+		{7, true},
+	} {
+		result.Count = test.count
+		assert.Equal(t, test.stable, cond(nil), "evaluation %d", i)
+	}
+}
+
+// countServer responds to count requests with each of counts in turn,
+// repeating the last one.
+func countServer(t *testing.T, counts ...int) (*espoll.Client, *int) {
+	var requests int
+	es := newTestClient(func(req *http.Request) (int, string) {
+		if strings.HasSuffix(req.URL.Path, "/_refresh") {
+			return http.StatusOK, `{}`
+		}
+		assert.Equal(t, "/traces-apm*/_count", req.URL.Path)
+		count := counts[min(requests, len(counts)-1)]
+		requests++
+		return http.StatusOK, fmt.Sprintf(`{"count":%d}`, count)
+	})
+	return es, &requests
+}
+
+func TestCountIndexMinDocs(t *testing.T) {
+	es, requests := countServer(t, 0, 1, 3)
+	count, err := es.CountIndexMinDocs(context.Background(), 2, "traces-apm*", nil,
+		espoll.WithInterval(time.Millisecond),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 3, *requests)
+}
+
+func TestWaitIndexNoDocs(t *testing.T) {
+	es, requests := countServer(t, 2, 1, 0)
+	count, err := es.WaitIndexNoDocs(context.Background(), "traces-apm*", nil,
+		espoll.WithInterval(time.Millisecond),
+	)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	assert.Equal(t, 3, *requests)
+
+	es, _ = countServer(t, 1)
+	count, err = es.WaitIndexNoDocs(context.Background(), "traces-apm*", nil,
+		espoll.WithInterval(time.Millisecond),
+		espoll.WithMaxAttempts(3),
+	)
+	assert.ErrorIs(t, err, espoll.ErrMaxAttempts)
+	assert.Equal(t, 1, count)
+}
+
+func TestWaitIndexStableCount(t *testing.T) {
+	es, requests := countServer(t, 1, 4, 9, 9, 9, 10)
+	count, err := es.WaitIndexStableCount(context.Background(), 2, "traces-apm*", nil,
+		espoll.WithInterval(time.Millisecond),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 9, count)
+	assert.Equal(t, 5, *requests)
+}
+
+func TestCountIndexRefreshesIndices(t *testing.T) {
+	var paths []string
+	es := newTestClient(func(req *http.Request) (int, string) {
+		paths = append(paths, req.URL.Path)
+		return http.StatusOK, `{"count":1}`
+	})
+	_, err := es.CountIndexMinDocs(context.Background(), 1, "traces-apm*,logs-apm*", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"/traces-apm*,logs-apm*/_refresh",
+		"/traces-apm*,logs-apm*/_count",
+	}, paths)
+}
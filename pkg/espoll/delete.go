@@ -0,0 +1,163 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+)
+
+// DeleteIndexDocs deletes documents in index matching query, returning
+// the number of documents deleted. The index may be a comma-separated
+// list of indices and data streams, and may contain wildcards; missing
+// indices are ignored.
+//
+// DeleteIndexDocs waits for the deletion to complete, and refreshes the
+// affected indices. Documents which are concurrently modified cause
+// version conflicts; in this case the deletion is repeated until there
+// are no conflicts, the timeout is reached, or the maximum number of
+// attempts have been made.
+func (es *Client) DeleteIndexDocs(
+	ctx context.Context,
+	index string,
+	query json.Marshaler,
+	opts ...RequestOption,
+) (int, error) {
+	req := es.NewDeleteByQueryRequest(index)
+	req.ExpandWildcards = "open,hidden"
+	req.Conflicts = "proceed"
+	ignoreUnavailable, refresh, waitForCompletion := true, true, true
+	req.IgnoreUnavailable = &ignoreUnavailable
+	req.Refresh = &refresh
+	req.WaitForCompletion = &waitForCompletion
+	if query == nil {
+		query = matchAllQuery{}
+	}
+	req = req.WithQuery(query)
+
+	var result DeleteByQueryResult
+	var deleted int
+	opts = append(opts, WithCondition(func(*esapi.Response) bool {
+		deleted += result.Deleted
+		return result.VersionConflicts == 0
+	}))
+	if _, err := req.Do(ctx, &result, opts...); err != nil {
+		return deleted, fmt.Errorf("failed deleting documents from %s: %w", index, err)
+	}
+	if len(result.Failures) > 0 {
+		return deleted, fmt.Errorf(
+			"failed deleting %d documents from %s: %s",
+			len(result.Failures), index, result.Failures[0],
+		)
+	}
+	return deleted, nil
+}
+
+// NewDeleteByQueryRequest returns a delete by query request using the
+// wrapped Elasticsearch client.
+func (es *Client) NewDeleteByQueryRequest(index string) *DeleteByQueryRequest {
+	req := &DeleteByQueryRequest{es: es}
+	req.Index = strings.Split(index, ",")
+	return req
+}
+
+// DeleteByQueryRequest wraps an esapi.DeleteByQueryRequest with a Client.
+type DeleteByQueryRequest struct {
+	esapi.DeleteByQueryRequest
+	es *Client
+}
+
+func (r *DeleteByQueryRequest) WithQuery(q any) *DeleteByQueryRequest {
+	var body struct {
+		Query any `json:"query"`
+	}
+	body.Query = q
+	r.Body = esutil.NewJSONReader(&body)
+	return r
+}
+
+func (r *DeleteByQueryRequest) Do(ctx context.Context, out *DeleteByQueryResult, opts ...RequestOption) (*esapi.Response, error) {
+	return r.es.Do(ctx, &r.DeleteByQueryRequest, out, opts...)
+}
+
+// DeleteByQueryResult holds the result of a delete by query request.
+type DeleteByQueryResult struct {
+	// Task holds the ID of the task performing the deletion,
+	// if the request did not wait for completion.
+	Task string `json:"task"`
+
+	Total            int               `json:"total"`
+	Deleted          int               `json:"deleted"`
+	VersionConflicts int               `json:"version_conflicts"`
+	Failures         []json.RawMessage `json:"failures"`
+}
+
+// RolloverDataStream rolls over the named data stream, so that
+// subsequent documents are written to a new backing index.
+func (es *Client) RolloverDataStream(ctx context.Context, name string) error {
+	req := esapi.IndicesRolloverRequest{Alias: name}
+	if _, err := es.Do(ctx, &req, nil); err != nil {
+		return fmt.Errorf("failed rolling over data stream %s: %w", name, err)
+	}
+	return nil
+}
+
+// DeleteDataStreams deletes the named data streams and their backing
+// indices. Names may contain wildcards, and data streams which do not
+// exist are ignored.
+//
+// Each name is deleted with a separate request, as Elasticsearch
+// rejects the whole request if any name without wildcards does not
+// exist. All names are attempted, and any errors are joined.
+func (es *Client) DeleteDataStreams(ctx context.Context, names ...string) error {
+	var errs []error
+	for _, name := range names {
+		if err := es.deleteDataStream(ctx, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (es *Client) deleteDataStream(ctx context.Context, name string) error {
+	req := esapi.IndicesDeleteDataStreamRequest{
+		Name:            []string{name},
+		ExpandWildcards: "all",
+	}
+	if _, err := es.Do(ctx, &req, nil); err != nil {
+		var esErr *Error
+		if errors.As(err, &esErr) && esErr.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("failed deleting data stream %s: %w", name, err)
+	}
+	return nil
+}
+
+type matchAllQuery struct{}
+
+func (matchAllQuery) MarshalJSON() ([]byte, error) {
+	return []byte(`{"match_all":{}}`), nil
+}
@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+func TestDeleteIndexDocsConflicts(t *testing.T) {
+	var requests []string
+	responses := []string{
+		`{"total": 3, "deleted": 2, "version_conflicts": 1, "failures": []}`,
+		`{"total": 1, "deleted": 1, "version_conflicts": 0, "failures": []}`,
+	}
+	es := newTestClient(func(req *http.Request) (int, string) {
+		body, _ := io.ReadAll(req.Body)
+		requests = append(requests, req.URL.Path+" "+string(body))
+		response := responses[0]
+		responses = responses[1:]
+		return http.StatusOK, response
+	})
+	deleted, err := es.DeleteIndexDocs(context.Background(), "traces-apm-default", nil,
+		espoll.WithInterval(time.Millisecond),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+	assert.Equal(t, []string{
+		`/traces-apm-default/_delete_by_query {"query":{"match_all":{}}}` + "\n",
+		`/traces-apm-default/_delete_by_query {"query":{"match_all":{}}}` + "\n",
+	}, requests)
+}
+
+func TestDeleteDataStreamsNotFound(t *testing.T) {
+	es := newTestClient(func(req *http.Request) (int, string) {
+		assert.Equal(t, http.MethodDelete, req.Method)
+		assert.Equal(t, "/_data_stream/logs-apm.app-test", req.URL.Path)
+		return http.StatusNotFound, `{"error": {"type": "index_not_found_exception"}}`
+	})
+	assert.NoError(t, es.DeleteDataStreams(context.Background(), "logs-apm.app-test"))
+}
+
+func TestDeleteDataStreams(t *testing.T) {
+	var requests []string
+	es := newTestClient(func(req *http.Request) (int, string) {
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		switch req.URL.Path {
+		case "/_data_stream/logs-apm.app-missing":
+			return http.StatusNotFound, `{"error": {"type": "index_not_found_exception"}}`
+		case "/_data_stream/metrics-apm.app-forbidden":
+			return http.StatusForbidden, `{"error": {"type": "security_exception"}}`
+		}
+		return http.StatusOK, `{"acknowledged": true}`
+	})
+	err := es.DeleteDataStreams(context.Background(),
+		"logs-apm.app-missing",
+		"metrics-apm.app-forbidden",
+		"traces-apm-*",
+	)
+
+	// Each data stream is deleted separately, so a missing
+	// data stream does not prevent the others being deleted.
+	assert.Equal(t, []string{
+		"DELETE /_data_stream/logs-apm.app-missing",
+		"DELETE /_data_stream/metrics-apm.app-forbidden",
+		"DELETE /_data_stream/traces-apm-*",
+	}, requests)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed deleting data stream metrics-apm.app-forbidden")
+	assert.NotContains(t, err.Error(), "logs-apm.app-missing")
+
+	assert.NoError(t, es.DeleteDataStreams(context.Background()))
+}
+
+func TestRolloverDataStream(t *testing.T) {
+	var requests []string
+	es := newTestClient(func(req *http.Request) (int, string) {
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		if strings.HasPrefix(req.URL.Path, "/logs-apm.app-missing/") {
+			return http.StatusNotFound, `{"error": {"type": "index_not_found_exception"}}`
+		}
+		return http.StatusOK, `{"acknowledged": true, "rolled_over": true}`
+	})
+	require.NoError(t, es.RolloverDataStream(context.Background(), "traces-apm-default"))
+	err := es.RolloverDataStream(context.Background(), "logs-apm.app-missing")
+	assert.ErrorContains(t, err, "failed rolling over data stream logs-apm.app-missing")
+
+	var esErr *espoll.Error
+	require.ErrorAs(t, err, &esErr)
+	assert.Equal(t, http.StatusNotFound, esErr.StatusCode)
+	assert.Equal(t, []string{
+		"POST /traces-apm-default/_rollover",
+		"POST /logs-apm.app-missing/_rollover",
+	}, requests)
+}
@@ -0,0 +1,280 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// diagnosticsTimeout is the maximum time spent diagnosing
+// a request whose condition was not met.
+const diagnosticsTimeout = 30 * time.Second
+
+// WithDiagnostics enables diagnosing why a search made by
+// SearchIndexMinDocs or CountIndexMinDocs did not match enough
+// documents before timing out. The diagnosis is included in the
+// returned error, which will be a *DiagnosedError.
+func WithDiagnostics() RequestOption {
+	return func(opts *requestOptions) {
+		opts.diagnose = true
+	}
+}
+
+// DiagnosedError wraps an error with a Diagnosis of its cause.
+type DiagnosedError struct {
+	Err       error
+	Diagnosis *Diagnosis
+}
+
+func (e *DiagnosedError) Error() string {
+	return fmt.Sprintf("%s\ndiagnosis: %s", e.Err, e.Diagnosis)
+}
+
+func (e *DiagnosedError) Unwrap() error {
+	return e.Err
+}
+
+// Diagnosis describes how many documents a query and its clauses match.
+type Diagnosis struct {
+	// Index holds the comma-separated list of indices diagnosed.
+	Index string
+
+	// MissingIndices holds the index expressions in Index
+	// that do not match any index, alias, or data stream.
+	MissingIndices []string
+
+	// Count holds the number of documents matching the query.
+	Count int
+
+	// Clauses holds the diagnosis of each filter, must, and must_not
+	// clause of a BoolQuery, in order. It is empty for other queries.
+	Clauses []ClauseDiagnosis
+
+	// ClausesError holds the reason a bool query's clauses could not
+	// be diagnosed, if its JSON could not be decoded as a BoolQuery.
+	ClausesError string
+}
+
+// ClauseDiagnosis describes how many documents a query clause matches.
+type ClauseDiagnosis struct {
+	// Clause describes the query clause.
+	Clause string
+
+	// Count holds the number of documents matching the clause alone.
+	Count int
+
+	// CumulativeCount holds the number of documents matching this
+	// clause and all of the clauses preceding it.
+	CumulativeCount int
+}
+
+func (d *Diagnosis) String() string {
+	var parts []string
+	for _, index := range d.MissingIndices {
+		parts = append(parts, fmt.Sprintf("%q matched no indices", index))
+	}
+	for i, c := range d.Clauses {
+		switch {
+		case i == 0:
+			parts = append(parts, fmt.Sprintf("%s matched %d docs", c.Clause, c.Count))
+		case c.Count == c.CumulativeCount:
+			parts = append(parts, fmt.Sprintf("adding %s matched %d", c.Clause, c.CumulativeCount))
+		default:
+			parts = append(parts, fmt.Sprintf(
+				"adding %s matched %d (%d alone)", c.Clause, c.CumulativeCount, c.Count,
+			))
+		}
+	}
+	if len(d.Clauses) == 0 {
+		part := fmt.Sprintf("query matched %d docs", d.Count)
+		if d.ClausesError != "" {
+			part += fmt.Sprintf(" (cannot diagnose clauses: %s)", d.ClausesError)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Diagnose reports which of index exist, and the number of documents
+// matching query. If query is a BoolQuery, or encodes a bool query
+// that can be decoded as one, the number of documents matching each of
+// its filter, must, and must_not clauses is reported, both alone and
+// cumulatively, to identify clauses which exclude all documents.
+func (es *Client) Diagnose(ctx context.Context, index string, query json.Marshaler) (*Diagnosis, error) {
+	d := &Diagnosis{Index: index}
+	for _, expr := range strings.Split(index, ",") {
+		exists, err := es.indexExists(ctx, expr)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			d.MissingIndices = append(d.MissingIndices, expr)
+		}
+	}
+
+	var err error
+	if d.Count, err = es.count(ctx, index, query); err != nil {
+		return nil, err
+	}
+	boolQuery, ok, err := asBoolQuery(query)
+	if err != nil {
+		d.ClausesError = err.Error()
+		return d, nil
+	} else if !ok {
+		return d, nil
+	}
+	var clauses, cumulative []any
+	clauses = append(clauses, boolQuery.Filter...)
+	clauses = append(clauses, boolQuery.Must...)
+	for _, clause := range boolQuery.MustNot {
+		clauses = append(clauses, BoolQuery{MustNot: []any{clause}})
+	}
+	for _, clause := range clauses {
+		cumulative = append(cumulative, clause)
+		count, err := es.count(ctx, index, BoolQuery{Filter: []any{clause}})
+		if err != nil {
+			return nil, err
+		}
+		cumulativeCount, err := es.count(ctx, index, BoolQuery{Filter: cumulative})
+		if err != nil {
+			return nil, err
+		}
+		d.Clauses = append(d.Clauses, ClauseDiagnosis{
+			Clause:          describeClause(clause),
+			Count:           count,
+			CumulativeCount: cumulativeCount,
+		})
+	}
+	return d, nil
+}
+
+// asBoolQuery returns query as a BoolQuery, decoding its JSON if it is
+// a bool query of another type. An error is returned if query is a bool
+// query with options that BoolQuery cannot represent.
+func asBoolQuery(query json.Marshaler) (BoolQuery, bool, error) {
+	switch q := query.(type) {
+	case nil:
+		return BoolQuery{}, false, nil
+	case BoolQuery:
+		return q, true, nil
+	case *BoolQuery:
+		return *q, true, nil
+	}
+	data, err := query.MarshalJSON()
+	if err != nil {
+		return BoolQuery{}, false, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil || m["bool"] == nil {
+		return BoolQuery{}, false, nil
+	}
+	var boolQuery BoolQuery
+	if err := json.Unmarshal(data, &boolQuery); err != nil {
+		return BoolQuery{}, false, err
+	}
+	return boolQuery, true, nil
+}
+
+// diagnose wraps err in a *DiagnosedError if diagnostics are enabled
+// in opts, and err was caused by the request timing out.
+func (es *Client) diagnose(ctx context.Context, err error, index string, query json.Marshaler, opts []RequestOption) error {
+	var requestOptions requestOptions
+	for _, opt := range opts {
+		opt(&requestOptions)
+	}
+	if !requestOptions.diagnose || !errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, diagnosticsTimeout)
+	defer cancel()
+	d, diagErr := es.Diagnose(ctx, index, query)
+	if diagErr != nil {
+		return fmt.Errorf("%w (diagnosis failed: %s)", err, diagErr)
+	}
+	return &DiagnosedError{Err: err, Diagnosis: d}
+}
+
+func (es *Client) indexExists(ctx context.Context, expr string) (bool, error) {
+	req := esapi.IndicesResolveIndexRequest{
+		Name:            []string{expr},
+		ExpandWildcards: "all",
+	}
+	var result struct {
+		Indices     []json.RawMessage `json:"indices"`
+		Aliases     []json.RawMessage `json:"aliases"`
+		DataStreams []json.RawMessage `json:"data_streams"`
+	}
+	if _, err := es.Do(ctx, req, &result); err != nil {
+		var esErr *Error
+		if errors.As(err, &esErr) && esErr.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed resolving index %q: %w", expr, err)
+	}
+	return len(result.Indices)+len(result.Aliases)+len(result.DataStreams) > 0, nil
+}
+
+func (es *Client) count(ctx context.Context, index string, query any) (int, error) {
+	req := es.NewCountRequest(index)
+	req.ExpandWildcards = "open,hidden"
+	ignoreUnavailable := true
+	req.IgnoreUnavailable = &ignoreUnavailable
+	if query != nil {
+		req = req.WithQuery(query)
+	}
+	var result CountResult
+	if _, err := req.Do(ctx, &result); err != nil {
+		return 0, fmt.Errorf("failed counting documents: %w", err)
+	}
+	return result.Count, nil
+}
+
+// describeClause returns a short description of a query clause.
+func describeClause(clause any) string {
+	switch q := clause.(type) {
+	case TermQuery:
+		return fmt.Sprintf("%s=%v", q.Field, q.Value)
+	case TermsQuery:
+		return fmt.Sprintf("%s in %v", q.Field, q.Values)
+	case ExistsQuery:
+		return fmt.Sprintf("exists(%s)", q.Field)
+	case MatchPhraseQuery:
+		return fmt.Sprintf("%s:%q", q.Field, q.Value)
+	case BoolQuery:
+		if len(q.MustNot) == 1 && len(q.Filter)+len(q.Must)+len(q.Should) == 0 {
+			return "not " + describeClause(q.MustNot[0])
+		}
+	}
+	data, err := json.Marshal(clause)
+	if err != nil {
+		return fmt.Sprint(clause)
+	}
+	const max = 200
+	if len(data) > max {
+		return string(data[:max]) + "..."
+	}
+	return string(data)
+}
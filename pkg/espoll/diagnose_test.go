@@ -0,0 +1,195 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+func TestDiagnosisString(t *testing.T) {
+	d := espoll.Diagnosis{
+		Index:          "traces-apm*,traces-missing*",
+		MissingIndices: []string{"traces-missing*"},
+		Count:          0,
+		Clauses: []espoll.ClauseDiagnosis{
+			{Clause: "service.name=svc", Count: 10, CumulativeCount: 10},
+			{Clause: "processor.event=span", Count: 4, CumulativeCount: 4},
+			{Clause: "not exists(span.id)", Count: 6, CumulativeCount: 0},
+		},
+	}
+	assert.Equal(t,
+		`"traces-missing*" matched no indices; `+
+			`service.name=svc matched 10 docs; `+
+			`adding processor.event=span matched 4; `+
+			`adding not exists(span.id) matched 0 (6 alone)`,
+		d.String(),
+	)
+
+	d = espoll.Diagnosis{Index: "traces-apm*", Count: 3}
+	assert.Equal(t, "query matched 3 docs", d.String())
+}
+
+// diagnoseServer responds to count requests with the number of documents
+// matching the query in counts, keyed by its JSON encoding. Otherwise the
+// query must be a bool query, and the minimum count of its filter clauses
+// is returned.
+func diagnoseServer(t *testing.T, counts map[string]int) *espoll.Client {
+	return newTestClient(func(req *http.Request) (int, string) {
+		switch {
+		case strings.HasPrefix(req.URL.Path, "/_resolve/index/"):
+			if strings.Contains(req.URL.Path, "missing") {
+				return http.StatusOK, `{"indices":[],"aliases":[],"data_streams":[]}`
+			}
+			return http.StatusOK, `{"data_streams":[{"name":"traces-apm-default"}]}`
+		case strings.HasSuffix(req.URL.Path, "/_count"):
+		default:
+			return http.StatusBadRequest, `{}`
+		}
+		query := gjson.GetBytes(readBody(req), "query")
+		count, ok := counts[query.Raw]
+		if ok {
+			data, _ := json.Marshal(map[string]int{"count": count})
+			return http.StatusOK, string(data)
+		}
+		count = -1
+		for _, filter := range query.Get("bool.filter").Array() {
+			n, ok := counts[filter.Raw]
+			require.True(t, ok, "unexpected clause %s", filter.Raw)
+			if count < 0 || n < count {
+				count = n
+			}
+		}
+		data, _ := json.Marshal(map[string]int{"count": count})
+		return http.StatusOK, string(data)
+	})
+}
+
+func TestDiagnose(t *testing.T) {
+	query := espoll.BoolQuery{
+		Filter: []any{
+			espoll.TermQuery{Field: "service.name", Value: "svc"},
+			espoll.TermsQuery{Field: "processor.event", Values: []any{"span", "transaction"}},
+		},
+		Must:    []any{espoll.MatchPhraseQuery{Field: "span.name", Value: "SELECT FROM users"}},
+		MustNot: []any{espoll.ExistsQuery{Field: "parent.id"}},
+	}
+	es := diagnoseServer(t, map[string]int{
+		`{"bool":{"filter":[{"term":{"service.name":{"value":"svc"}}},{"terms":{"processor.event":["span","transaction"]}}],"must":[{"match_phrase":{"span.name":"SELECT FROM users"}}],"must_not":[{"exists":{"field":"parent.id"}}]}}`: 0,
+		`{"term":{"service.name":{"value":"svc"}}}`:                10,
+		`{"terms":{"processor.event":["span","transaction"]}}`:     8,
+		`{"match_phrase":{"span.name":"SELECT FROM users"}}`:       2,
+		`{"bool":{"must_not":[{"exists":{"field":"parent.id"}}]}}`: 0,
+	})
+	d, err := es.Diagnose(context.Background(), "traces-apm*,traces-missing*", query)
+	require.NoError(t, err)
+	assert.Equal(t, &espoll.Diagnosis{
+		Index:          "traces-apm*,traces-missing*",
+		MissingIndices: []string{"traces-missing*"},
+		Count:          0,
+		Clauses: []espoll.ClauseDiagnosis{
+			{Clause: "service.name=svc", Count: 10, CumulativeCount: 10},
+			{Clause: "processor.event in [span transaction]", Count: 8, CumulativeCount: 8},
+			{Clause: `span.name:"SELECT FROM users"`, Count: 2, CumulativeCount: 2},
+			{Clause: "not exists(parent.id)", Count: 0, CumulativeCount: 0},
+		},
+	}, d)
+}
+
+func TestDiagnoseDecodedQuery(t *testing.T) {
+	// Bool queries decoded from JSON are diagnosed clause by clause,
+	// with clauses described by their JSON.
+	var query espoll.BoolQuery
+	require.NoError(t, json.Unmarshal([]byte(`{"bool":{
+		"filter": {"range": {"@timestamp": {"gte": "now-1h"}}},
+		"must_not": [{"term": {"event.outcome": "success"}}]
+	}}`), &query))
+	es := diagnoseServer(t, map[string]int{
+		`{"range":{"@timestamp":{"gte":"now-1h"}}}`:                    5,
+		`{"bool":{"must_not":[{"term":{"event.outcome":"success"}}]}}`: 1,
+	})
+	d, err := es.Diagnose(context.Background(), "traces-apm*", query)
+	require.NoError(t, err)
+	assert.Equal(t, []espoll.ClauseDiagnosis{
+		{Clause: `{"range":{"@timestamp":{"gte":"now-1h"}}}`, Count: 5, CumulativeCount: 5},
+		{Clause: `not {"term":{"event.outcome":"success"}}`, Count: 1, CumulativeCount: 1},
+	}, d.Clauses)
+}
+
+func TestDiagnoseRawQuery(t *testing.T) {
+	// Bool queries are diagnosed from their JSON encoding, and only
+	// if they can be decoded as a BoolQuery without losing options.
+	es := diagnoseServer(t, map[string]int{
+		`{"bool":{"filter":[{"term":{"service.name":"svc"}}]}}`:             2,
+		`{"bool":{"_name":"q","filter":[{"term":{"service.name":"svc"}}]}}`: 2,
+		`{"term":{"service.name":"svc"}}`:                                   2,
+	})
+	d, err := es.Diagnose(context.Background(), "traces-apm*",
+		rawQuery(`{"bool":{"filter":[{"term":{"service.name":"svc"}}]}}`),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []espoll.ClauseDiagnosis{
+		{Clause: `{"term":{"service.name":"svc"}}`, Count: 2, CumulativeCount: 2},
+	}, d.Clauses)
+
+	d, err = es.Diagnose(context.Background(), "traces-apm*",
+		rawQuery(`{"bool":{"_name":"q","filter":[{"term":{"service.name":"svc"}}]}}`),
+	)
+	require.NoError(t, err)
+	assert.Empty(t, d.Clauses)
+	assert.Equal(t, 2, d.Count)
+	assert.Contains(t, d.ClausesError, `unknown field "_name"`)
+	assert.Contains(t, d.String(), "query matched 2 docs (cannot diagnose clauses: ")
+
+	d, err = es.Diagnose(context.Background(), "traces-apm*",
+		rawQuery(`{"term":{"service.name":"svc"}}`),
+	)
+	require.NoError(t, err)
+	assert.Empty(t, d.Clauses)
+	assert.Empty(t, d.ClausesError)
+	assert.Equal(t, "query matched 2 docs", d.String())
+}
+
+type rawQuery string
+
+func (q rawQuery) MarshalJSON() ([]byte, error) { return []byte(q), nil }
+
+func TestDiagnoseOnTimeout(t *testing.T) {
+	es := diagnoseServer(t, map[string]int{`{"term":{"service.name":{"value":"svc"}}}`: 0})
+	_, err := es.CountIndexMinDocs(context.Background(), 1, "traces-apm*",
+		espoll.BoolQuery{Filter: []any{espoll.TermQuery{Field: "service.name", Value: "svc"}}},
+		espoll.WithInterval(time.Millisecond),
+		espoll.WithTimeout(10*time.Millisecond),
+		espoll.WithDiagnostics(),
+	)
+	var diagnosed *espoll.DiagnosedError
+	require.True(t, errors.As(err, &diagnosed), "%v", err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "diagnosis: service.name=svc matched 0 docs")
+}
@@ -0,0 +1,234 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package espolltest provides testing.TB helpers for asserting on
+// documents in Elasticsearch using espoll.
+package espolltest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+const (
+	// deadlineMargin is the time left before the test deadline for
+	// reporting failures, when deriving timeouts from the deadline.
+	deadlineMargin = 5 * time.Second
+
+	// maxSampleHits is the maximum number of hits included
+	// in failure messages.
+	maxSampleHits = 3
+
+	// maxSampleSource is the maximum number of bytes of each
+	// sample hit's source included in failure messages.
+	maxSampleSource = 512
+
+	// cleanupTimeout is the timeout for requests made by cleanup
+	// functions, which run after the test context is cancelled.
+	cleanupTimeout = 30 * time.Second
+)
+
+// RequireMinDocs searches index for at least min documents matching query,
+// failing the test if they are not found within the timeout, and otherwise
+// returning the results.
+//
+// Unless overridden in opts, the timeout is derived from the test deadline.
+func RequireMinDocs(
+	t testing.TB, es *espoll.Client,
+	min int, index string,
+	query json.Marshaler,
+	opts ...espoll.RequestOption,
+) espoll.SearchResult {
+	t.Helper()
+	result, err := es.SearchIndexMinDocs(t.Context(), min, index, query, withDeadline(t, opts)...)
+	if err != nil {
+		t.Fatalf("expected at least %d docs in %s: %s", min, index, describeFailure(err, query, result))
+	}
+	return result
+}
+
+// RequireNoDocs waits until there are no documents in index matching query,
+// failing the test if they remain after the timeout.
+//
+// Unless overridden in opts, the timeout is derived from the test deadline.
+func RequireNoDocs(
+	t testing.TB, es *espoll.Client,
+	index string,
+	query json.Marshaler,
+	opts ...espoll.RequestOption,
+) {
+	t.Helper()
+	if count, err := es.WaitIndexNoDocs(t.Context(), index, query, withDeadline(t, opts)...); err != nil {
+		t.Fatalf("expected no docs in %s: %s\nlast response: %d matching docs",
+			index, describeError(err, query), count,
+		)
+	}
+}
+
+// RequireEventually searches index with query until cond returns true for
+// the search result, failing the test if it does not within the timeout,
+// and otherwise returning the result.
+//
+// Unless overridden in opts, the timeout is derived from the test deadline.
+func RequireEventually(
+	t testing.TB, es *espoll.Client,
+	index string,
+	query json.Marshaler,
+	cond func(espoll.SearchResult) bool,
+	opts ...espoll.RequestOption,
+) espoll.SearchResult {
+	t.Helper()
+	var result espoll.SearchResult
+	req := es.NewSearchRequest(index)
+	req.ExpandWildcards = "open,hidden"
+	if query != nil {
+		req = req.WithQuery(query)
+	}
+	opts = append(withDeadline(t, opts), espoll.WithCondition(func(*esapi.Response) bool {
+		return cond(result)
+	}))
+	if _, err := req.Do(t.Context(), &result, opts...); err != nil {
+		t.Fatalf("condition not met for %s: %s", index, describeFailure(err, query, result))
+	}
+	return result
+}
+
+// OpenPointInTime opens a point in time for index, closing it when the
+// test and its subtests complete.
+func OpenPointInTime(t testing.TB, es *espoll.Client, index string) string {
+	t.Helper()
+	id, err := es.OpenPointInTime(t.Context(), index)
+	if err != nil {
+		t.Fatalf("failed to open point in time for %s: %s", index, err)
+	}
+	t.Cleanup(func() {
+		// t.Context is cancelled before cleanup functions run.
+		ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		if err := es.ClosePointInTime(ctx, id); err != nil {
+			t.Logf("failed to close point in time: %s", err)
+		}
+	})
+	return id
+}
+
+// DeleteDocs deletes documents in index matching query, failing the test
+// if they cannot be deleted. A nil query deletes all documents in index.
+//
+// Unless overridden in opts, the timeout is derived from the test deadline.
+func DeleteDocs(
+	t testing.TB, es *espoll.Client,
+	index string,
+	query json.Marshaler,
+	opts ...espoll.RequestOption,
+) {
+	t.Helper()
+	if _, err := es.DeleteIndexDocs(t.Context(), index, query, withDeadline(t, opts)...); err != nil {
+		t.Fatalf("failed to delete docs: %s", err)
+	}
+}
+
+// CleanupDocs deletes documents in index matching query when the test
+// and its subtests complete. A nil query deletes all documents in index.
+func CleanupDocs(t testing.TB, es *espoll.Client, index string, query json.Marshaler) {
+	t.Helper()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		if _, err := es.DeleteIndexDocs(ctx, index, query, espoll.WithTimeout(cleanupTimeout)); err != nil {
+			t.Errorf("failed to delete docs: %s", err)
+		}
+	})
+}
+
+// CleanupDataStreams deletes the named data streams when the test
+// and its subtests complete. Names may contain wildcards.
+func CleanupDataStreams(t testing.TB, es *espoll.Client, names ...string) {
+	t.Helper()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		if err := es.DeleteDataStreams(ctx, names...); err != nil {
+			t.Errorf("failed to delete data streams: %s", err)
+		}
+	})
+}
+
+// withDeadline returns opts with a timeout derived from the test
+// deadline prepended, so that it may be overridden by opts.
+func withDeadline(t testing.TB, opts []espoll.RequestOption) []espoll.RequestOption {
+	d, ok := t.(interface{ Deadline() (time.Time, bool) })
+	if !ok {
+		return opts
+	}
+	deadline, ok := d.Deadline()
+	if !ok {
+		return opts
+	}
+	timeout := time.Until(deadline) - deadlineMargin
+	if timeout <= 0 {
+		timeout = time.Until(deadline) / 2
+	}
+	return append([]espoll.RequestOption{espoll.WithTimeout(timeout)}, opts...)
+}
+
+// describeFailure formats err along with the query and
+// a summary of the last search result, for test failures.
+func describeFailure(err error, query json.Marshaler, result espoll.SearchResult) string {
+	var buf strings.Builder
+	buf.WriteString(describeError(err, query))
+	fmt.Fprintf(&buf, "\nlast response: %d total hits (%s), %d returned",
+		result.Hits.Total.Value, result.Hits.Total.Relation, len(result.Hits.Hits),
+	)
+	for i, hit := range result.Hits.Hits {
+		if i == maxSampleHits {
+			fmt.Fprintf(&buf, "\n  ... %d more", len(result.Hits.Hits)-maxSampleHits)
+			break
+		}
+		source := string(hit.RawSource)
+		if len(source) > maxSampleSource {
+			source = source[:maxSampleSource] + "..."
+		}
+		fmt.Fprintf(&buf, "\n  %s/%s: %s", hit.Index, hit.ID, source)
+	}
+	return buf.String()
+}
+
+// describeError formats err along with the query, and the number
+// of attempts made if err is an *espoll.PollError.
+func describeError(err error, query json.Marshaler) string {
+	var buf strings.Builder
+	buf.WriteString(err.Error())
+	if query != nil {
+		if body, err := json.MarshalIndent(query, "", "  "); err == nil {
+			fmt.Fprintf(&buf, "\nquery:\n%s", body)
+		}
+	}
+	var pollErr *espoll.PollError
+	if errors.As(err, &pollErr) {
+		fmt.Fprintf(&buf, "\nattempts: %d, elapsed: %s", pollErr.Attempts, pollErr.Elapsed.Round(time.Millisecond))
+	}
+	return buf.String()
+}
@@ -0,0 +1,249 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espolltest_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+	"github.com/elastic/apm-tools/pkg/espoll/espolltest"
+)
+
+// fakeTB records test failures and cleanup functions. Fatalf stops
+// the calling goroutine, so helpers must be called using run.
+type fakeTB struct {
+	testing.TB
+	errors   []string
+	fatal    string
+	cleanups []func()
+}
+
+func (tb *fakeTB) Helper()                  {}
+func (tb *fakeTB) Context() context.Context { return context.Background() }
+func (tb *fakeTB) Logf(string, ...any)      {}
+func (tb *fakeTB) Cleanup(f func())         { tb.cleanups = append(tb.cleanups, f) }
+
+func (tb *fakeTB) Errorf(format string, args ...any) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func (tb *fakeTB) Fatalf(format string, args ...any) {
+	tb.fatal = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+// run calls f with tb in a new goroutine, so that Fatalf can stop it.
+func (tb *fakeTB) run(f func(testing.TB)) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(tb)
+	}()
+	<-done
+}
+
+// runCleanups runs the cleanup functions in last-in, first-out order.
+func (tb *fakeTB) runCleanups() {
+	for i := len(tb.cleanups) - 1; i >= 0; i-- {
+		tb.cleanups[i]()
+	}
+}
+
+// transportFunc is an esapi.Transport implemented by a function.
+type transportFunc func(*http.Request) (*http.Response, error)
+
+func (f transportFunc) Perform(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newTestClient returns a client which responds to requests with
+// the status code and body returned by handler, failing requests
+// whose context is done.
+func newTestClient(handler func(*http.Request) (int, string)) *espoll.Client {
+	return espoll.New(transportFunc(func(req *http.Request) (*http.Response, error) {
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+		status, body := handler(req)
+		return &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	}))
+}
+
+var fastPoll = []espoll.RequestOption{
+	espoll.WithInterval(time.Millisecond),
+	espoll.WithMaxAttempts(2),
+}
+
+func TestRequireMinDocsFailure(t *testing.T) {
+	es := newTestClient(func(req *http.Request) (int, string) {
+		return http.StatusOK, `{"hits":{"total":{"value":1,"relation":"eq"},"hits":[
+			{"_index":"traces-apm-default","_id":"abc","_source":{"service":{"name":"svc"}},"fields":{}}
+		]}}`
+	})
+	tb := &fakeTB{}
+	tb.run(func(t testing.TB) {
+		espolltest.RequireMinDocs(t, es, 2, "traces-apm*",
+			espoll.TermQuery{Field: "service.name", Value: "svc"},
+			fastPoll...,
+		)
+	})
+	assert.Contains(t, tb.fatal, "expected at least 2 docs in traces-apm*: ")
+	assert.Contains(t, tb.fatal, `"service.name": {`)
+	assert.Contains(t, tb.fatal, "attempts: 2, elapsed: ")
+	assert.Contains(t, tb.fatal, "last response: 1 total hits (eq), 1 returned")
+	assert.Contains(t, tb.fatal, `traces-apm-default/abc: {"service":{"name":"svc"}}`)
+}
+
+func TestRequireMinDocsSuccess(t *testing.T) {
+	es := newTestClient(func(req *http.Request) (int, string) {
+		return http.StatusOK, `{"hits":{"total":{"value":1,"relation":"eq"},"hits":[
+			{"_index":"traces-apm-default","_id":"abc","_source":{},"fields":{}}
+		]}}`
+	})
+	tb := &fakeTB{}
+	var result espoll.SearchResult
+	tb.run(func(t testing.TB) {
+		result = espolltest.RequireMinDocs(t, es, 1, "traces-apm*", nil, fastPoll...)
+	})
+	assert.Empty(t, tb.fatal)
+	assert.Len(t, result.Hits.Hits, 1)
+}
+
+func TestRequireNoDocsFailure(t *testing.T) {
+	es := newTestClient(func(req *http.Request) (int, string) {
+		return http.StatusOK, `{"count":7}`
+	})
+	tb := &fakeTB{}
+	tb.run(func(t testing.TB) {
+		espolltest.RequireNoDocs(t, es, "traces-apm*", nil, fastPoll...)
+	})
+	assert.Contains(t, tb.fatal, "expected no docs in traces-apm*: ")
+	assert.Contains(t, tb.fatal, "attempts: 2, elapsed: ")
+	assert.Contains(t, tb.fatal, "last response: 7 matching docs")
+	assert.NotContains(t, tb.fatal, "total hits")
+}
+
+func TestRequireEventuallyFailure(t *testing.T) {
+	es := newTestClient(func(req *http.Request) (int, string) {
+		return http.StatusOK, `{"hits":{"total":{"value":5,"relation":"gte"},"hits":[
+			{"_index":"a","_id":"1","_source":{},"fields":{}},
+			{"_index":"a","_id":"2","_source":{},"fields":{}},
+			{"_index":"a","_id":"3","_source":{},"fields":{}},
+			{"_index":"a","_id":"4","_source":{},"fields":{}}
+		]}}`
+	})
+	tb := &fakeTB{}
+	tb.run(func(t testing.TB) {
+		espolltest.RequireEventually(t, es, "traces-apm*", nil,
+			func(result espoll.SearchResult) bool { return false },
+			fastPoll...,
+		)
+	})
+	assert.Contains(t, tb.fatal, "condition not met for traces-apm*: ")
+	assert.Contains(t, tb.fatal, "last response: 5 total hits (gte), 4 returned")
+	assert.Contains(t, tb.fatal, "a/3: {}\n  ... 1 more")
+	assert.NotContains(t, tb.fatal, "a/4")
+}
+
+func TestOpenPointInTimeClosedOnCleanup(t *testing.T) {
+	var requests []string
+	es := newTestClient(func(req *http.Request) (int, string) {
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		return http.StatusOK, `{"id":"pit"}`
+	})
+	tb := &fakeTB{}
+	var id string
+	tb.run(func(t testing.TB) { id = espolltest.OpenPointInTime(t, es, "traces-apm*") })
+	require.Empty(t, tb.fatal)
+	assert.Equal(t, "pit", id)
+	assert.Equal(t, []string{"POST /traces-apm*/_pit"}, requests)
+	tb.runCleanups()
+	assert.Equal(t, []string{"POST /traces-apm*/_pit", "DELETE /_pit"}, requests)
+}
+
+func TestCleanupDocs(t *testing.T) {
+	var requests []string
+	es := newTestClient(func(req *http.Request) (int, string) {
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		return http.StatusOK, `{"total":2,"deleted":2,"version_conflicts":0,"failures":[]}`
+	})
+	tb := &fakeTB{}
+	tb.run(func(t testing.TB) { espolltest.CleanupDocs(t, es, "traces-apm*", nil) })
+	assert.Empty(t, requests)
+	tb.runCleanups()
+	assert.Equal(t, []string{"POST /traces-apm*/_delete_by_query"}, requests)
+	assert.Empty(t, tb.errors)
+}
+
+func TestCleanupDocsFailure(t *testing.T) {
+	es := newTestClient(func(req *http.Request) (int, string) {
+		return http.StatusBadRequest, `{"error":{"type":"parsing_exception","reason":"bad query"}}`
+	})
+	tb := &fakeTB{}
+	tb.run(func(t testing.TB) { espolltest.CleanupDocs(t, es, "traces-apm*", nil) })
+	tb.runCleanups()
+	require.Len(t, tb.errors, 1)
+	assert.Contains(t, tb.errors[0], "failed to delete docs: ")
+	assert.Empty(t, tb.fatal)
+}
+
+func TestCleanupDataStreams(t *testing.T) {
+	var requests []string
+	es := newTestClient(func(req *http.Request) (int, string) {
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		if req.URL.Path == "/_data_stream/logs-apm.app-missing" {
+			return http.StatusNotFound, `{"error":{"type":"index_not_found_exception"}}`
+		}
+		return http.StatusOK, `{"acknowledged":true}`
+	})
+	tb := &fakeTB{}
+	tb.run(func(t testing.TB) {
+		espolltest.CleanupDataStreams(t, es, "logs-apm.app-missing", "traces-apm-*")
+	})
+	assert.Empty(t, requests)
+	tb.runCleanups()
+	assert.Equal(t, []string{
+		"DELETE /_data_stream/logs-apm.app-missing",
+		"DELETE /_data_stream/traces-apm-*",
+	}, requests)
+	assert.Empty(t, tb.errors)
+}
+
+func TestCleanupDataStreamsFailure(t *testing.T) {
+	es := newTestClient(func(req *http.Request) (int, string) {
+		return http.StatusForbidden, `{"error":{"type":"security_exception"}}`
+	})
+	tb := &fakeTB{}
+	tb.run(func(t testing.TB) { espolltest.CleanupDataStreams(t, es, "traces-apm-*") })
+	tb.runCleanups()
+	require.Len(t, tb.errors, 1)
+	assert.Contains(t, tb.errors[0], "failed to delete data streams: failed deleting data stream traces-apm-*")
+}
@@ -0,0 +1,133 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+)
+
+// ESQLMinRows runs the ES|QL query with the given positional
+// parameters, returning the results.
+//
+// If the query returns fewer than min rows within the timeout,
+// ESQLMinRows will return an error.
+func (es *Client) ESQLMinRows(
+	ctx context.Context,
+	min int, query string,
+	params []any,
+	opts ...RequestOption,
+) (ESQLResult, error) {
+	var result ESQLResult
+	req := es.NewESQLRequest(query).WithParams(params...)
+	opts = append(opts, WithCondition(result.MinRowsCondition(min)))
+	if _, err := req.Do(ctx, &result, opts...); err != nil {
+		return result, fmt.Errorf("failed issuing request: %w", err)
+	}
+	return result, nil
+}
+
+// NewESQLRequest returns an ES|QL query request using the wrapped
+// Elasticsearch client.
+func (es *Client) NewESQLRequest(query string) *ESQLRequest {
+	req := &ESQLRequest{es: es, query: query}
+	req.Format = "json"
+	return req
+}
+
+// ESQLRequest wraps an esapi.EsqlQueryRequest with a Client.
+type ESQLRequest struct {
+	esapi.EsqlQueryRequest
+	es     *Client
+	query  string
+	params []any
+	filter any
+}
+
+// WithParams sets values for the positional "?" parameters in the query.
+func (r *ESQLRequest) WithParams(params ...any) *ESQLRequest {
+	r.params = params
+	return r
+}
+
+// WithFilter sets a Query DSL filter to apply to the
+// documents before the query is evaluated.
+func (r *ESQLRequest) WithFilter(q any) *ESQLRequest {
+	r.filter = q
+	return r
+}
+
+func (r *ESQLRequest) Do(ctx context.Context, out *ESQLResult, opts ...RequestOption) (*esapi.Response, error) {
+	var body struct {
+		Query  string `json:"query"`
+		Params []any  `json:"params,omitempty"`
+		Filter any    `json:"filter,omitempty"`
+	}
+	body.Query = r.query
+	body.Params = r.params
+	body.Filter = r.filter
+	r.Body = esutil.NewJSONReader(&body)
+	return r.es.Do(ctx, &r.EsqlQueryRequest, out, opts...)
+}
+
+// ESQLResult holds the columnar result of an ES|QL query.
+type ESQLResult struct {
+	Columns []ESQLColumn `json:"columns"`
+	Values  [][]any      `json:"values"`
+}
+
+type ESQLColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Rows returns the result rows as maps of column name to value.
+func (r *ESQLResult) Rows() []map[string]any {
+	rows := make([]map[string]any, len(r.Values))
+	for i, values := range r.Values {
+		row := make(map[string]any, len(r.Columns))
+		for j, column := range r.Columns {
+			if j < len(values) {
+				row[column.Name] = values[j]
+			}
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// MinRowsCondition returns a ConditionFunc which will return true if the
+// number of rows in r is at least min.
+func (r *ESQLResult) MinRowsCondition(min int) ConditionFunc {
+	return func(*esapi.Response) bool { return len(r.Values) >= min }
+}
+
+// MaxRowsCondition returns a ConditionFunc which will return true if the
+// number of rows in r is at most max.
+func (r *ESQLResult) MaxRowsCondition(max int) ConditionFunc {
+	return func(*esapi.Response) bool { return len(r.Values) <= max }
+}
+
+// ExactRowsCondition returns a ConditionFunc which will return true if the
+// number of rows in r is exactly n.
+func (r *ESQLResult) ExactRowsCondition(n int) ConditionFunc {
+	return func(*esapi.Response) bool { return len(r.Values) == n }
+}
@@ -0,0 +1,111 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+func TestESQLMinRows(t *testing.T) {
+	responses := []string{
+		`{"columns":[{"name":"service.name","type":"keyword"},{"name":"count","type":"long"}],"values":[]}`,
+		`{"columns":[{"name":"service.name","type":"keyword"},{"name":"count","type":"long"}],"values":[["a",1],["b",2]]}`,
+	}
+	var bodies []string
+	es := newTestClient(func(req *http.Request) (int, string) {
+		assert.Equal(t, "/_query", req.URL.Path)
+		assert.Equal(t, "json", req.URL.Query().Get("format"))
+		bodies = append(bodies, string(readBody(req)))
+		response := responses[0]
+		if len(responses) > 1 {
+			responses = responses[1:]
+		}
+		return http.StatusOK, response
+	})
+	result, err := es.ESQLMinRows(context.Background(), 2,
+		"FROM traces-apm* | WHERE service.environment == ? | STATS count = COUNT(*) BY service.name",
+		[]any{"production"},
+		espoll.WithInterval(time.Millisecond),
+	)
+	require.NoError(t, err)
+	require.Len(t, bodies, 2)
+	assert.JSONEq(t, `{
+		"query": "FROM traces-apm* | WHERE service.environment == ? | STATS count = COUNT(*) BY service.name",
+		"params": ["production"]
+	}`, bodies[0])
+	// The body must be sent again when the request is retried.
+	assert.Equal(t, bodies[0], bodies[1])
+	assert.Equal(t, []map[string]any{
+		{"service.name": "a", "count": float64(1)},
+		{"service.name": "b", "count": float64(2)},
+	}, result.Rows())
+}
+
+func TestESQLRequestFilter(t *testing.T) {
+	var body string
+	es := newTestClient(func(req *http.Request) (int, string) {
+		body = string(readBody(req))
+		return http.StatusOK, `{"columns":[],"values":[]}`
+	})
+	var result espoll.ESQLResult
+	_, err := es.NewESQLRequest("FROM logs-apm*").
+		WithFilter(espoll.TermQuery{Field: "service.name", Value: "svc"}).
+		Do(context.Background(), &result)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"query": "FROM logs-apm*",
+		"filter": {"term": {"service.name": {"value": "svc"}}}
+	}`, body)
+}
+
+func TestESQLRowsConditions(t *testing.T) {
+	var result espoll.ESQLResult
+	minRows := result.MinRowsCondition(1)
+	maxRows := result.MaxRowsCondition(1)
+	exactRows := result.ExactRowsCondition(1)
+	assert.False(t, minRows(nil))
+	assert.True(t, maxRows(nil))
+	assert.False(t, exactRows(nil))
+
+	result.Values = [][]any{{"a"}}
+	assert.True(t, minRows(nil))
+	assert.True(t, maxRows(nil))
+	assert.True(t, exactRows(nil))
+
+	result.Values = append(result.Values, []any{"b"})
+	assert.True(t, minRows(nil))
+	assert.False(t, maxRows(nil))
+	assert.False(t, exactRows(nil))
+}
+
+func TestESQLResultRowsShort(t *testing.T) {
+	// Rows with fewer values than columns omit the missing columns.
+	result := espoll.ESQLResult{
+		Columns: []espoll.ESQLColumn{{Name: "a"}, {Name: "b"}},
+		Values:  [][]any{{"x"}},
+	}
+	assert.Equal(t, []map[string]any{{"a": "x"}}, result.Rows())
+}
@@ -0,0 +1,172 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+)
+
+const (
+	// maxResultWindow is the default value of index.max_result_window,
+	// the maximum number of hits that can be returned by a single search.
+	maxResultWindow = 10000
+
+	defaultIteratePageSize = 1000
+	pointInTimeKeepAlive   = "1m"
+)
+
+// Iterate searches for all documents matching the request, calling fn
+// for each hit in order. Iterate stops at the first error returned by
+// fn, and returns it.
+//
+// Iterate opens a point in time and pages through results using
+// search_after, so it is not subject to index.max_result_window.
+// The page size is taken from the request's Size if set, and
+// defaults to 1000 otherwise.
+//
+// Each page is searched with the request's query, _source, fields,
+// runtime fields, collapse and post filter options. Aggregations are
+// not calculated, and total hits are not tracked. If the request
+// collapses results, it must be sorted by the collapse field.
+func (r *SearchRequest) Iterate(ctx context.Context, fn func(SearchHit) error) error {
+	pitID, err := r.es.openPointInTime(ctx, r.Index, r.ExpandWildcards)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Close the point in time even if ctx has been cancelled.
+		r.es.closePointInTime(context.WithoutCancel(ctx), pitID)
+	}()
+
+	size := defaultIteratePageSize
+	if r.Size != nil && *r.Size > 0 {
+		size = *r.Size
+	}
+	var body struct {
+		searchBody
+		Size        int      `json:"size"`
+		Sort        []string `json:"sort,omitempty"`
+		SearchAfter []any    `json:"search_after,omitempty"`
+		PIT         struct {
+			ID        string `json:"id"`
+			KeepAlive string `json:"keep_alive"`
+		} `json:"pit"`
+	}
+	// Aggregations would be recalculated for every page,
+	// and total hits are not needed for pagination.
+	body.searchBody = r.body
+	body.Aggregations = nil
+	body.TrackTotalHits = false
+	if body.Fields == nil {
+		body.Fields = []string{"*"}
+	}
+	body.Size = size
+	body.PIT.KeepAlive = pointInTimeKeepAlive
+	if len(r.Sort) == 0 {
+		// Sort by _shard_doc for the most efficient pagination.
+		body.Sort = []string{"_shard_doc"}
+	}
+	for {
+		body.PIT.ID = pitID
+		req := r.SearchRequest
+		req.Index = nil
+		req.ExpandWildcards = ""
+		req.Size = nil
+		req.TrackTotalHits = false
+		req.Body = esutil.NewJSONReader(&body)
+
+		var result struct {
+			PITID string     `json:"pit_id"`
+			Hits  SearchHits `json:"hits"`
+		}
+		if _, err := r.es.Do(ctx, &req, &result); err != nil {
+			return fmt.Errorf("failed issuing request: %w", err)
+		}
+		if result.PITID != "" {
+			pitID = result.PITID
+		}
+		for _, hit := range result.Hits.Hits {
+			if err := fn(hit); err != nil {
+				return err
+			}
+		}
+		if len(result.Hits.Hits) < size {
+			return nil
+		}
+		body.SearchAfter = result.Hits.Hits[len(result.Hits.Hits)-1].Sort
+	}
+}
+
+// SearchAll searches for all documents matching the request using
+// Iterate, returning the hits in a single SearchResult.
+func (r *SearchRequest) SearchAll(ctx context.Context) (SearchResult, error) {
+	var result SearchResult
+	err := r.Iterate(ctx, func(hit SearchHit) error {
+		result.Hits.Hits = append(result.Hits.Hits, hit)
+		return nil
+	})
+	result.Hits.Total = SearchHitsTotal{Value: len(result.Hits.Hits), Relation: "eq"}
+	return result, err
+}
+
+// OpenPointInTime opens a point in time for the comma-separated list of
+// indices, returning its ID. The point in time is kept alive for one
+// minute after each search that uses it, and should be closed with
+// ClosePointInTime when no longer needed.
+func (es *Client) OpenPointInTime(ctx context.Context, index string) (string, error) {
+	return es.openPointInTime(ctx, strings.Split(index, ","), "open,hidden")
+}
+
+// ClosePointInTime closes a point in time opened with OpenPointInTime.
+func (es *Client) ClosePointInTime(ctx context.Context, id string) error {
+	return es.closePointInTime(ctx, id)
+}
+
+func (es *Client) openPointInTime(ctx context.Context, index []string, expandWildcards string) (string, error) {
+	req := esapi.OpenPointInTimeRequest{
+		Index:           index,
+		ExpandWildcards: expandWildcards,
+		KeepAlive:       pointInTimeKeepAlive,
+	}
+	var result struct {
+		ID string `json:"id"`
+	}
+	if _, err := es.Do(ctx, req, &result); err != nil {
+		return "", fmt.Errorf("failed opening point in time: %w", err)
+	}
+	return result.ID, nil
+}
+
+func (es *Client) closePointInTime(ctx context.Context, id string) error {
+	body, err := json.Marshal(map[string]string{"id": id})
+	if err != nil {
+		return err
+	}
+	req := esapi.ClosePointInTimeRequest{Body: bytes.NewReader(body)}
+	if _, err := es.Do(ctx, req, nil); err != nil {
+		return fmt.Errorf("failed closing point in time: %w", err)
+	}
+	return nil
+}
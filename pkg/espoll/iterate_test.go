@@ -0,0 +1,207 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+// pitServer emulates point in time searches over n documents,
+// whose IDs and sort values are their positions.
+type pitServer struct {
+	n         int
+	searchErr bool
+
+	requests []string
+	closed   []string
+}
+
+func (s *pitServer) handle(req *http.Request) (int, string) {
+	body := readBody(req)
+	switch {
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/_pit"):
+		s.requests = append(s.requests, "open "+req.URL.Path)
+		return http.StatusOK, `{"id":"pit0"}`
+	case req.Method == http.MethodDelete && req.URL.Path == "/_pit":
+		s.closed = append(s.closed, gjson.GetBytes(body, "id").String())
+		return http.StatusOK, `{"succeeded":true}`
+	case req.URL.Path != "/_search":
+		return http.StatusBadRequest, `{}`
+	}
+	search := gjson.ParseBytes(body)
+	s.requests = append(s.requests, fmt.Sprintf("search pit=%s after=%s",
+		search.Get("pit.id"), search.Get("search_after").Raw,
+	))
+	if s.searchErr {
+		return http.StatusInternalServerError, `{"error":{"type":"search_phase_execution_exception"}}`
+	}
+	from := 0
+	if after := search.Get("search_after.0"); after.Exists() {
+		from = int(after.Int()) + 1
+	}
+	hits := []map[string]any{}
+	for i := from; i < s.n && len(hits) < int(search.Get("size").Int()); i++ {
+		hits = append(hits, map[string]any{
+			"_index": "index", "_id": fmt.Sprint(i), "_source": map[string]any{}, "fields": map[string]any{}, "sort": []int{i},
+		})
+	}
+	// Each response returns a new point in time ID, which must be
+	// used in the following search.
+	out, _ := json.Marshal(map[string]any{
+		"pit_id": fmt.Sprintf("pit%d", len(s.requests)-1),
+		"hits":   map[string]any{"hits": hits},
+	})
+	return http.StatusOK, string(out)
+}
+
+func iterateIDs(t *testing.T, es *espoll.Client, size int) ([]string, error) {
+	var ids []string
+	err := es.NewSearchRequest("index").WithSize(size).Iterate(context.Background(), func(hit espoll.SearchHit) error {
+		ids = append(ids, hit.ID)
+		return nil
+	})
+	return ids, err
+}
+
+func TestIteratePages(t *testing.T) {
+	srv := &pitServer{n: 5}
+	ids, err := iterateIDs(t, newTestClient(srv.handle), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0", "1", "2", "3", "4"}, ids)
+	assert.Equal(t, []string{
+		"open /index/_pit",
+		"search pit=pit0 after=",
+		"search pit=pit1 after=[1]",
+		"search pit=pit2 after=[3]",
+	}, srv.requests)
+	assert.Equal(t, []string{"pit3"}, srv.closed)
+}
+
+func TestIterateFullLastPage(t *testing.T) {
+	// When the last page is full, another search is needed
+	// to find that there are no more hits.
+	srv := &pitServer{n: 4}
+	ids, err := iterateIDs(t, newTestClient(srv.handle), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0", "1", "2", "3"}, ids)
+	assert.Equal(t, []string{
+		"open /index/_pit",
+		"search pit=pit0 after=",
+		"search pit=pit1 after=[1]",
+		"search pit=pit2 after=[3]",
+	}, srv.requests)
+	assert.Equal(t, []string{"pit3"}, srv.closed)
+}
+
+func TestIterateBody(t *testing.T) {
+	var body string
+	es := newTestClient(func(req *http.Request) (int, string) {
+		switch req.URL.Path {
+		case "/index/_pit":
+			return http.StatusOK, `{"id":"pit0"}`
+		case "/_search":
+			body = string(readBody(req))
+		}
+		return http.StatusOK, `{"hits":{"hits":[]}}`
+	})
+	err := es.NewSearchRequest("index").
+		WithQuery(espoll.TermQuery{Field: "service.name", Value: "svc"}).
+		WithAggregation("services", espoll.NewTermsAggregation("service.name")).
+		WithTrackTotalHits(true).
+		Iterate(context.Background(), func(espoll.SearchHit) error { return nil })
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"query": {"term": {"service.name": {"value": "svc"}}},
+		"fields": ["*"],
+		"size": 1000,
+		"sort": ["_shard_doc"],
+		"track_total_hits": false,
+		"pit": {"id": "pit0", "keep_alive": "1m"}
+	}`, body)
+}
+
+func TestIterateClosesPointInTime(t *testing.T) {
+	t.Run("callback_error", func(t *testing.T) {
+		srv := &pitServer{n: 5}
+		errStop := errors.New("stop")
+		err := newTestClient(srv.handle).NewSearchRequest("index").WithSize(2).Iterate(
+			context.Background(), func(hit espoll.SearchHit) error {
+				if hit.ID == "2" {
+					return errStop
+				}
+				return nil
+			},
+		)
+		assert.ErrorIs(t, err, errStop)
+		assert.Equal(t, []string{"pit2"}, srv.closed)
+	})
+	t.Run("search_error", func(t *testing.T) {
+		srv := &pitServer{n: 5, searchErr: true}
+		_, err := iterateIDs(t, newTestClient(srv.handle), 2)
+		assert.ErrorContains(t, err, "search_phase_execution_exception")
+		assert.Equal(t, []string{"pit0"}, srv.closed)
+	})
+	t.Run("context_cancelled", func(t *testing.T) {
+		srv := &pitServer{n: 5}
+		ctx, cancel := context.WithCancel(context.Background())
+		err := newTestClient(srv.handle).NewSearchRequest("index").WithSize(2).Iterate(
+			ctx, func(hit espoll.SearchHit) error {
+				cancel()
+				return nil
+			},
+		)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, []string{"pit1"}, srv.closed)
+	})
+}
+
+func TestSearchAll(t *testing.T) {
+	srv := &pitServer{n: 3}
+	result, err := newTestClient(srv.handle).NewSearchRequest("index").WithSize(2).SearchAll(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, result.Hits.Hits, 3)
+	assert.Equal(t, espoll.SearchHitsTotal{Value: 3, Relation: "eq"}, result.Hits.Total)
+}
+
+func TestOpenClosePointInTime(t *testing.T) {
+	var requests []string
+	es := newTestClient(func(req *http.Request) (int, string) {
+		requests = append(requests, req.Method+" "+req.URL.RequestURI()+" "+string(readBody(req)))
+		return http.StatusOK, `{"id":"pit0"}`
+	})
+	id, err := es.OpenPointInTime(context.Background(), "traces-apm*,logs-apm*")
+	require.NoError(t, err)
+	assert.Equal(t, "pit0", id)
+	require.NoError(t, es.ClosePointInTime(context.Background(), id))
+	assert.Equal(t, []string{
+		"POST /traces-apm*,logs-apm*/_pit?expand_wildcards=open%2Chidden&keep_alive=1m ",
+		`DELETE /_pit {"id":"pit0"}`,
+	}, requests)
+}
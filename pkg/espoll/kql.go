@@ -0,0 +1,380 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// KQLError is returned by ParseKQL for invalid queries.
+type KQLError struct {
+	// Offset holds the byte offset in the query at which
+	// the error was detected.
+	Offset int
+	Msg    string
+}
+
+func (e *KQLError) Error() string {
+	return fmt.Sprintf("invalid KQL at offset %d: %s", e.Offset, e.Msg)
+}
+
+// ParseKQL parses a Kibana Query Language (KQL) query, returning
+// an equivalent query composed of the query types in this package.
+//
+// The following subset of KQL is supported:
+//
+//   - field:value, matching documents with the exact value using a
+//     TermQuery. Quoted values are matched with a MatchPhraseQuery.
+//   - field:value* with unquoted wildcards, using a WildcardQuery.
+//   - field:*, matching documents with the field using an ExistsQuery.
+//   - field>value, field>=value, field<value and field<=value,
+//     using a RangeQuery.
+//   - field:(value or value), matching any or all of several values.
+//   - and, or, and not operators, which are case-insensitive and
+//     combined with BoolQuery, and parentheses for grouping.
+//
+// Special characters may be escaped with a backslash. Free-text
+// queries without a field, and wildcards in field names, are not
+// supported.
+func ParseKQL(kql string) (json.Marshaler, error) {
+	tokens, err := lexKQL(kql)
+	if err != nil {
+		return nil, err
+	}
+	p := &kqlParser{tokens: tokens}
+	q, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != kqlEOF {
+		return nil, p.unexpected(tok)
+	}
+	return q, nil
+}
+
+type kqlTokenKind int
+
+const (
+	kqlEOF kqlTokenKind = iota
+	kqlLParen
+	kqlRParen
+	kqlColon
+	kqlRange
+	kqlAnd
+	kqlOr
+	kqlNot
+	kqlWord
+	kqlQuoted
+)
+
+type kqlToken struct {
+	kind   kqlTokenKind
+	offset int
+
+	// text holds the token's text, with escapes removed.
+	text string
+
+	// pattern holds a word's text as a wildcard pattern, with
+	// escaped wildcards escaped, and wildcard reports whether
+	// the word contains unescaped wildcards.
+	pattern  string
+	wildcard bool
+}
+
+// kqlSpecial holds the characters which terminate a word
+// unless escaped.
+const kqlSpecial = `\():<>"*`
+
+func lexKQL(kql string) ([]kqlToken, error) {
+	var tokens []kqlToken
+	for i := 0; i < len(kql); {
+		c := kql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, kqlToken{kind: kqlLParen, offset: i, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, kqlToken{kind: kqlRParen, offset: i, text: ")"})
+			i++
+		case c == ':':
+			tokens = append(tokens, kqlToken{kind: kqlColon, offset: i, text: ":"})
+			i++
+		case c == '<' || c == '>':
+			op := string(c)
+			if i+1 < len(kql) && kql[i+1] == '=' {
+				op += "="
+			}
+			tokens = append(tokens, kqlToken{kind: kqlRange, offset: i, text: op})
+			i += len(op)
+		case c == '"':
+			start := i
+			var sb strings.Builder
+			for i++; ; i++ {
+				if i == len(kql) {
+					return nil, &KQLError{Offset: start, Msg: "unterminated quoted string"}
+				}
+				if kql[i] == '\\' && i+1 < len(kql) {
+					i++
+				} else if kql[i] == '"' {
+					i++
+					break
+				}
+				sb.WriteByte(kql[i])
+			}
+			tokens = append(tokens, kqlToken{kind: kqlQuoted, offset: start, text: sb.String()})
+		default:
+			start := i
+			var text, pattern strings.Builder
+			var wildcard bool
+			for ; i < len(kql); i++ {
+				c := kql[i]
+				if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+					break
+				}
+				if c == '\\' {
+					if i+1 == len(kql) {
+						return nil, &KQLError{Offset: i, Msg: "trailing backslash"}
+					}
+					i++
+					c = kql[i]
+					text.WriteByte(c)
+					if c == '*' || c == '?' || c == '\\' {
+						pattern.WriteByte('\\')
+					}
+					pattern.WriteByte(c)
+					continue
+				}
+				if c == '*' {
+					wildcard = true
+					text.WriteByte(c)
+					pattern.WriteByte(c)
+					continue
+				}
+				if strings.IndexByte(kqlSpecial, c) >= 0 {
+					break
+				}
+				text.WriteByte(c)
+				if c == '?' {
+					// KQL does not support single character
+					// wildcards, so escape them in patterns.
+					pattern.WriteByte('\\')
+				}
+				pattern.WriteByte(c)
+			}
+			tok := kqlToken{
+				kind:     kqlWord,
+				offset:   start,
+				text:     text.String(),
+				pattern:  pattern.String(),
+				wildcard: wildcard,
+			}
+			switch strings.ToLower(kql[start:i]) {
+			case "and":
+				tok.kind = kqlAnd
+			case "or":
+				tok.kind = kqlOr
+			case "not":
+				tok.kind = kqlNot
+			}
+			tokens = append(tokens, tok)
+		}
+	}
+	return append(tokens, kqlToken{kind: kqlEOF, offset: len(kql)}), nil
+}
+
+// kqlParser is a recursive descent parser for KQL.
+//
+// Each parse method takes the field to which values apply,
+// which is non-empty inside field:(...) value groups.
+type kqlParser struct {
+	tokens []kqlToken
+	pos    int
+}
+
+func (p *kqlParser) peek() kqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *kqlParser) next() kqlToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != kqlEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *kqlParser) unexpected(tok kqlToken) error {
+	if tok.kind == kqlEOF {
+		return &KQLError{Offset: tok.offset, Msg: "unexpected end of query"}
+	}
+	return &KQLError{Offset: tok.offset, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+}
+
+func (p *kqlParser) parseOr(field string) (json.Marshaler, error) {
+	q, err := p.parseAnd(field)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != kqlOr {
+		return q, nil
+	}
+	should := []any{q}
+	for p.peek().kind == kqlOr {
+		p.next()
+		q, err := p.parseAnd(field)
+		if err != nil {
+			return nil, err
+		}
+		should = append(should, q)
+	}
+	return BoolQuery{Should: should, MinimumShouldMatch: 1}, nil
+}
+
+func (p *kqlParser) parseAnd(field string) (json.Marshaler, error) {
+	q, err := p.parseNot(field)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != kqlAnd {
+		return q, nil
+	}
+	filter := []any{q}
+	for p.peek().kind == kqlAnd {
+		p.next()
+		q, err := p.parseNot(field)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, q)
+	}
+	return BoolQuery{Filter: filter}, nil
+}
+
+func (p *kqlParser) parseNot(field string) (json.Marshaler, error) {
+	if p.peek().kind != kqlNot {
+		return p.parsePrimary(field)
+	}
+	p.next()
+	q, err := p.parseNot(field)
+	if err != nil {
+		return nil, err
+	}
+	return BoolQuery{MustNot: []any{q}}, nil
+}
+
+func (p *kqlParser) parsePrimary(field string) (json.Marshaler, error) {
+	tok := p.next()
+	switch tok.kind {
+	case kqlLParen:
+		q, err := p.parseOr(field)
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != kqlRParen {
+			return nil, p.unexpected(tok)
+		}
+		return q, nil
+	case kqlWord, kqlQuoted:
+		if field != "" {
+			return kqlValueQuery(field, tok), nil
+		}
+		return p.parseField(tok)
+	}
+	return nil, p.unexpected(tok)
+}
+
+// parseField parses the remainder of a field:value or
+// field <op> value expression, following the field name.
+func (p *kqlParser) parseField(fieldTok kqlToken) (json.Marshaler, error) {
+	if fieldTok.kind != kqlWord {
+		return nil, &KQLError{Offset: fieldTok.offset, Msg: "expected field name, free-text search is not supported"}
+	}
+	if fieldTok.wildcard {
+		return nil, &KQLError{Offset: fieldTok.offset, Msg: "wildcards in field names are not supported"}
+	}
+	field := fieldTok.text
+	switch tok := p.next(); tok.kind {
+	case kqlColon:
+		switch value := p.peek(); value.kind {
+		case kqlLParen:
+			return p.parsePrimary(field)
+		case kqlWord, kqlQuoted:
+			p.next()
+			return kqlValueQuery(field, value), nil
+		default:
+			return nil, p.unexpected(value)
+		}
+	case kqlRange:
+		value := p.next()
+		if value.kind != kqlWord && value.kind != kqlQuoted {
+			return nil, p.unexpected(value)
+		}
+		q := NewRangeQuery(field)
+		v := kqlValue(value)
+		switch tok.text {
+		case ">":
+			q = q.WithGt(v)
+		case ">=":
+			q = q.WithGte(v)
+		case "<":
+			q = q.WithLt(v)
+		case "<=":
+			q = q.WithLte(v)
+		}
+		return q, nil
+	case kqlEOF:
+		return nil, &KQLError{Offset: fieldTok.offset, Msg: fmt.Sprintf("expected ':' or range operator after %q", field)}
+	default:
+		return nil, p.unexpected(tok)
+	}
+}
+
+// kqlValueQuery returns a query matching field against a value token.
+func kqlValueQuery(field string, tok kqlToken) json.Marshaler {
+	switch {
+	case tok.kind == kqlQuoted:
+		return MatchPhraseQuery{Field: field, Value: tok.text}
+	case tok.pattern == "*":
+		return ExistsQuery{Field: field}
+	case tok.wildcard:
+		return NewWildcardQuery(field, tok.pattern)
+	}
+	return TermQuery{Field: field, Value: kqlValue(tok)}
+}
+
+// kqlValue returns the value of a token, as a json.Number
+// if it is an unquoted number, and otherwise as a string.
+func kqlValue(tok kqlToken) any {
+	if tok.kind == kqlWord && tok.text != "" && (tok.text[0] == '-' || isDigit(tok.text[0])) {
+		// Check the value is a valid JSON number, which
+		// excludes values such as "0x10" and "-Inf".
+		var n json.Number
+		if json.Unmarshal([]byte(tok.text), &n) == nil {
+			return n
+		}
+	}
+	return tok.text
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
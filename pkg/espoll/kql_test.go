@@ -0,0 +1,109 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+func TestParseKQL(t *testing.T) {
+	for name, test := range map[string]struct {
+		kql      string
+		expected string
+	}{
+		"term": {
+			kql:      `service.name:foo`,
+			expected: `{"term":{"service.name":{"value":"foo"}}}`,
+		},
+		"phrase": {
+			kql:      `transaction.name:"GET /api/\"x\""`,
+			expected: `{"match_phrase":{"transaction.name":"GET /api/\"x\""}}`,
+		},
+		"wildcard": {
+			kql: `service.name:opbeans-* and not url.path:\*`,
+			expected: `{"bool":{"filter":[
+				{"wildcard":{"service.name":{"value":"opbeans-*"}}},
+				{"bool":{"must_not":[{"term":{"url.path":{"value":"*"}}}]}}
+			]}}`,
+		},
+		"exists": {
+			kql:      `span.destination.service.resource:*`,
+			expected: `{"exists":{"field":"span.destination.service.resource"}}`,
+		},
+		"precedence": {
+			kql: `service.name:foo and transaction.duration.us > 1000000 and not event.outcome:success or trace.id:abc`,
+			expected: `{"bool":{"minimum_should_match":1,"should":[
+				{"bool":{"filter":[
+					{"term":{"service.name":{"value":"foo"}}},
+					{"range":{"transaction.duration.us":{"gt":1000000}}},
+					{"bool":{"must_not":[{"term":{"event.outcome":{"value":"success"}}}]}}
+				]}},
+				{"term":{"trace.id":{"value":"abc"}}}
+			]}}`,
+		},
+		"parentheses": {
+			kql: `(a:1 OR b:2) AND c <= now-1h`,
+			expected: `{"bool":{"filter":[
+				{"bool":{"minimum_should_match":1,"should":[
+					{"term":{"a":{"value":1}}},
+					{"term":{"b":{"value":2}}}
+				]}},
+				{"range":{"c":{"lte":"now-1h"}}}
+			]}}`,
+		},
+		"value_group": {
+			kql: `processor.event:(transaction or span)`,
+			expected: `{"bool":{"minimum_should_match":1,"should":[
+				{"term":{"processor.event":{"value":"transaction"}}},
+				{"term":{"processor.event":{"value":"span"}}}
+			]}}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			q, err := espoll.ParseKQL(test.kql)
+			require.NoError(t, err)
+			data, err := json.Marshal(q)
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expected, string(data))
+		})
+	}
+}
+
+func TestParseKQLErrors(t *testing.T) {
+	for kql, expected := range map[string]string{
+		`service.name:`:        "invalid KQL at offset 13: unexpected end of query",
+		`(a:b`:                 "invalid KQL at offset 4: unexpected end of query",
+		`a:"b`:                 "invalid KQL at offset 2: unterminated quoted string",
+		`foo`:                  `invalid KQL at offset 0: expected ':' or range operator after "foo"`,
+		`"foo"`:                "invalid KQL at offset 0: expected field name, free-text search is not supported",
+		`service.*:foo`:        "invalid KQL at offset 0: wildcards in field names are not supported",
+		`a:b c:d`:              `invalid KQL at offset 4: unexpected "c"`,
+		`a:b and or c:d`:       `invalid KQL at offset 8: unexpected "or"`,
+		`a:b)`:                 `invalid KQL at offset 3: unexpected ")"`,
+		`transaction.id > and`: `invalid KQL at offset 17: unexpected "and"`,
+	} {
+		_, err := espoll.ParseKQL(kql)
+		assert.EqualError(t, err, expected, kql)
+	}
+}
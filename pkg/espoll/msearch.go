@@ -0,0 +1,193 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// WaitSearch describes a search, and a condition on its result,
+// for use with WaitAll.
+type WaitSearch struct {
+	// Name identifies the search when reporting which searches
+	// are still pending. If unspecified, Index is used.
+	Name string
+
+	// Index holds a comma-separated list of indices to search.
+	Index string
+
+	// Query holds the search query. If nil, all documents match.
+	Query any
+
+	// Size holds the maximum number of hits to return.
+	// If zero, Elasticsearch returns up to 10 hits.
+	Size int
+
+	// Result receives the result of the search each time it is
+	// executed, until Condition is met. If nil, a new SearchResult
+	// will be allocated.
+	Result *SearchResult
+
+	// Condition is evaluated after Result has been updated. If nil,
+	// the condition is that Result has at least one hit.
+	Condition ConditionFunc
+}
+
+func (s *WaitSearch) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Index
+}
+
+// WaitAll waits for all of the searches' conditions to be met,
+// combining the searches whose conditions have not yet been met
+// into a single multi-search request on each poll.
+//
+// If the conditions are not all met within the timeout, WaitAll
+// returns an error that names the pending searches.
+func (es *Client) WaitAll(ctx context.Context, searches []*WaitSearch, opts ...RequestOption) error {
+	var indices []string
+	for _, s := range searches {
+		if s.Result == nil {
+			s.Result = &SearchResult{}
+		}
+		if s.Condition == nil {
+			s.Condition = s.Result.Hits.NonEmptyCondition()
+		}
+		indices = append(indices, s.Index)
+	}
+	if err := es.refresh(ctx, strings.Join(indices, ",")); err != nil {
+		return err
+	}
+
+	req := &msearchRequest{
+		es:       es,
+		searches: searches,
+		pending:  make(map[*WaitSearch]string),
+	}
+	for _, s := range searches {
+		req.pending[s] = "no response"
+	}
+	opts = append(opts, WithCondition(req.condition))
+	if _, err := es.Do(ctx, req, &req.result, opts...); err != nil {
+		var pending []string
+		for _, s := range searches {
+			if reason, ok := req.pending[s]; ok {
+				pending = append(pending, fmt.Sprintf("%s (%s)", s.name(), reason))
+			}
+		}
+		return fmt.Errorf("failed waiting for searches: %w; pending: %s", err, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// msearchRequest is a Request which issues a multi-search
+// request for the pending searches.
+type msearchRequest struct {
+	es       *Client
+	searches []*WaitSearch
+
+	// pending holds the searches whose conditions have not been
+	// met, and a description of the most recent result.
+	pending map[*WaitSearch]string
+
+	// inflight holds the pending searches in the order they were
+	// included in the most recent request.
+	inflight []*WaitSearch
+
+	result struct {
+		Responses []json.RawMessage `json:"responses"`
+	}
+}
+
+func (r *msearchRequest) Do(ctx context.Context, _ esapi.Transport) (*esapi.Response, error) {
+	// The request body changes as searches are satisfied, so we must
+	// bypass the transport passed in by Client.Do, which repeats the
+	// body of the first request.
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	r.inflight = r.inflight[:0]
+	for _, s := range r.searches {
+		if _, ok := r.pending[s]; !ok {
+			continue
+		}
+		r.inflight = append(r.inflight, s)
+		header := map[string]any{
+			"index":            strings.Split(s.Index, ","),
+			"expand_wildcards": "open,hidden",
+		}
+		search := map[string]any{
+			"fields":           []string{"*"},
+			"track_total_hits": true,
+		}
+		if s.Query != nil {
+			search["query"] = s.Query
+		}
+		if s.Size > 0 {
+			search["size"] = s.Size
+		}
+		if err := enc.Encode(header); err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(search); err != nil {
+			return nil, err
+		}
+	}
+	req := esapi.MsearchRequest{Body: &body}
+	return req.Do(ctx, r.es)
+}
+
+// condition updates the results of in-flight searches, evaluating
+// their conditions, and returns true once there are none pending.
+func (r *msearchRequest) condition(resp *esapi.Response) bool {
+	for i, s := range r.inflight {
+		if i >= len(r.result.Responses) {
+			break
+		}
+		raw := r.result.Responses[i]
+		var itemError struct {
+			Error json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal(raw, &itemError); err != nil {
+			r.pending[s] = err.Error()
+			continue
+		}
+		if len(itemError.Error) > 0 {
+			r.pending[s] = "error: " + string(itemError.Error)
+			continue
+		}
+		*s.Result = SearchResult{}
+		if err := json.Unmarshal(raw, s.Result); err != nil {
+			r.pending[s] = err.Error()
+			continue
+		}
+		if s.Condition(resp) {
+			delete(r.pending, s)
+			continue
+		}
+		r.pending[s] = fmt.Sprintf("%d hits", s.Result.Hits.Total.Value)
+	}
+	return len(r.pending) == 0
+}
@@ -0,0 +1,135 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+// msearchServer responds to each search in a multi-search request with
+// respond(index, poll), recording the indices searched by each request.
+func msearchServer(t *testing.T, respond func(index string, poll int) string) (*espoll.Client, *[][]string) {
+	var polls [][]string
+	es := newTestClient(func(req *http.Request) (int, string) {
+		if strings.HasSuffix(req.URL.Path, "/_refresh") {
+			return http.StatusOK, `{}`
+		}
+		require.Equal(t, "/_msearch", req.URL.Path)
+		var indices, responses []string
+		scanner := bufio.NewScanner(bytes.NewReader(readBody(req)))
+		for scanner.Scan() {
+			index := gjson.Get(scanner.Text(), "index.0").String()
+			require.True(t, scanner.Scan())
+			indices = append(indices, index)
+			responses = append(responses, respond(index, len(polls)))
+		}
+		polls = append(polls, indices)
+		return http.StatusOK, `{"responses":[` + strings.Join(responses, ",") + `]}`
+	})
+	return es, &polls
+}
+
+func hitsResponse(n int) string {
+	hits := make([]map[string]any, n)
+	for i := range hits {
+		hits[i] = map[string]any{"_index": "index", "_id": fmt.Sprint(i), "_source": map[string]any{}, "fields": map[string]any{}}
+	}
+	data, _ := json.Marshal(map[string]any{
+		"hits": map[string]any{"total": map[string]any{"value": n, "relation": "eq"}, "hits": hits},
+	})
+	return string(data)
+}
+
+func TestWaitAllPartial(t *testing.T) {
+	es, polls := msearchServer(t, func(index string, poll int) string {
+		switch {
+		case index == "a":
+			return hitsResponse(1)
+		case index == "b" && poll >= 2:
+			return hitsResponse(3)
+		}
+		return hitsResponse(0)
+	})
+	a := &espoll.WaitSearch{Index: "a"}
+	b := &espoll.WaitSearch{Index: "b"}
+	require.NoError(t, es.WaitAll(context.Background(), []*espoll.WaitSearch{a, b},
+		espoll.WithInterval(time.Millisecond),
+	))
+	// Satisfied searches are dropped from subsequent requests.
+	assert.Equal(t, [][]string{{"a", "b"}, {"b"}, {"b"}}, *polls)
+	assert.Equal(t, 1, a.Result.Hits.Total.Value)
+	assert.Equal(t, 3, b.Result.Hits.Total.Value)
+}
+
+func TestWaitAllItemError(t *testing.T) {
+	es, polls := msearchServer(t, func(index string, poll int) string {
+		if index == "b" && poll == 0 {
+			return `{"error":{"type":"index_not_found_exception"},"status":404}`
+		}
+		return hitsResponse(2)
+	})
+	var result espoll.SearchResult
+	searches := []*espoll.WaitSearch{
+		{Index: "a"},
+		{Index: "b", Result: &result, Condition: result.Hits.MinHitsCondition(2)},
+	}
+	require.NoError(t, es.WaitAll(context.Background(), searches,
+		espoll.WithInterval(time.Millisecond),
+	))
+	assert.Equal(t, [][]string{{"a", "b"}, {"b"}}, *polls)
+	assert.Len(t, result.Hits.Hits, 2)
+}
+
+func TestWaitAllTimeout(t *testing.T) {
+	es, _ := msearchServer(t, func(index string, poll int) string {
+		switch index {
+		case "a":
+			return hitsResponse(1)
+		case "b":
+			return `{"error":{"type":"index_not_found_exception"},"status":404}`
+		}
+		return hitsResponse(0)
+	})
+	err := es.WaitAll(context.Background(), []*espoll.WaitSearch{
+		{Index: "a"},
+		{Index: "b"},
+		{Name: "errors", Index: "c"},
+	},
+		espoll.WithInterval(time.Millisecond),
+		espoll.WithTimeout(20*time.Millisecond),
+	)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(),
+		`pending: b (error: {"type":"index_not_found_exception"}), errors (0 hits)`,
+	)
+}
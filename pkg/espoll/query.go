@@ -17,7 +17,12 @@
 
 package espoll
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 type BoolQuery struct {
 	Filter             []any
@@ -40,6 +45,57 @@ func (q BoolQuery) MarshalJSON() ([]byte, error) {
 	return encodeQueryJSON("bool", boolQuery(q))
 }
 
+// UnmarshalJSON decodes a bool query. Each clause is decoded as a
+// json.RawMessage, and a single clause may be given as an object
+// rather than an array. Options that BoolQuery cannot represent,
+// such as _name, are rejected rather than silently dropped.
+func (q *BoolQuery) UnmarshalJSON(data []byte) error {
+	var args struct {
+		Filter             json.RawMessage `json:"filter"`
+		Must               json.RawMessage `json:"must"`
+		MustNot            json.RawMessage `json:"must_not"`
+		Should             json.RawMessage `json:"should"`
+		MinimumShouldMatch int             `json:"minimum_should_match"`
+		Boost              float64         `json:"boost"`
+	}
+	var raw json.RawMessage
+	if err := decodeQueryJSON("bool", data, &raw); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&args); err != nil {
+		return fmt.Errorf("cannot decode bool query: %w", err)
+	}
+	*q = BoolQuery{MinimumShouldMatch: args.MinimumShouldMatch, Boost: args.Boost}
+	for _, clauses := range []struct {
+		raw json.RawMessage
+		out *[]any
+	}{
+		{args.Filter, &q.Filter},
+		{args.Must, &q.Must},
+		{args.MustNot, &q.MustNot},
+		{args.Should, &q.Should},
+	} {
+		raw := bytes.TrimSpace(clauses.raw)
+		if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+			continue
+		}
+		if raw[0] != '[' {
+			*clauses.out = []any{clauses.raw}
+			continue
+		}
+		var list []json.RawMessage
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return err
+		}
+		for _, clause := range list {
+			*clauses.out = append(*clauses.out, clause)
+		}
+	}
+	return nil
+}
+
 type ExistsQuery struct {
 	Field string
 }
@@ -93,7 +149,537 @@ func (q MatchPhraseQuery) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// RangeQuery matches documents with field values within a range.
+//
+// The bounds may be numbers, strings, time.Time values, or DateMath
+// expressions.
+type RangeQuery struct {
+	Field    string
+	Gt       any
+	Gte      any
+	Lt       any
+	Lte      any
+	Format   string
+	TimeZone string
+	Relation string
+	Boost    float64
+}
+
+type rangeQuery struct {
+	Gt       any     `json:"gt,omitempty"`
+	Gte      any     `json:"gte,omitempty"`
+	Lt       any     `json:"lt,omitempty"`
+	Lte      any     `json:"lte,omitempty"`
+	Format   string  `json:"format,omitempty"`
+	TimeZone string  `json:"time_zone,omitempty"`
+	Relation string  `json:"relation,omitempty"`
+	Boost    float64 `json:"boost,omitempty"`
+}
+
+// NewRangeQuery returns a RangeQuery for field with no bounds.
+func NewRangeQuery(field string) RangeQuery {
+	return RangeQuery{Field: field}
+}
+
+func (q RangeQuery) WithGt(v any) RangeQuery           { q.Gt = v; return q }
+func (q RangeQuery) WithGte(v any) RangeQuery          { q.Gte = v; return q }
+func (q RangeQuery) WithLt(v any) RangeQuery           { q.Lt = v; return q }
+func (q RangeQuery) WithLte(v any) RangeQuery          { q.Lte = v; return q }
+func (q RangeQuery) WithFormat(f string) RangeQuery    { q.Format = f; return q }
+func (q RangeQuery) WithTimeZone(tz string) RangeQuery { q.TimeZone = tz; return q }
+func (q RangeQuery) WithRelation(r string) RangeQuery  { q.Relation = r; return q }
+func (q RangeQuery) WithBoost(b float64) RangeQuery    { q.Boost = b; return q }
+
+func (q RangeQuery) MarshalJSON() ([]byte, error) {
+	return encodeQueryJSON("range", map[string]any{
+		q.Field: rangeQuery{
+			q.Gt, q.Gte, q.Lt, q.Lte,
+			q.Format, q.TimeZone, q.Relation, q.Boost,
+		},
+	})
+}
+
+func (q *RangeQuery) UnmarshalJSON(data []byte) error {
+	var args rangeQuery
+	field, err := decodeFieldQueryJSON("range", data, &args, nil)
+	if err != nil {
+		return err
+	}
+	*q = RangeQuery{
+		field, args.Gt, args.Gte, args.Lt, args.Lte,
+		args.Format, args.TimeZone, args.Relation, args.Boost,
+	}
+	return nil
+}
+
+// DateMath holds an Elasticsearch date math expression,
+// such as "now-15m/m".
+//
+// See https://www.elastic.co/guide/en/elasticsearch/reference/current/common-options.html#date-math
+type DateMath string
+
+// Now returns a DateMath expression for the current time.
+func Now() DateMath {
+	return "now"
+}
+
+// Add returns a DateMath expression for d after dm.
+//
+// Date math has a resolution of one second, so d is rounded
+// away from zero to a whole number of seconds.
+func (dm DateMath) Add(d time.Duration) DateMath {
+	if d < 0 {
+		return dm.Sub(-d)
+	}
+	return dm + "+" + DateMath(formatDateMathDuration(d))
+}
+
+// Sub returns a DateMath expression for d before dm.
+//
+// Date math has a resolution of one second, so d is rounded
+// away from zero to a whole number of seconds.
+func (dm DateMath) Sub(d time.Duration) DateMath {
+	if d < 0 {
+		return dm.Add(-d)
+	}
+	return dm + "-" + DateMath(formatDateMathDuration(d))
+}
+
+// Round returns a DateMath expression rounding dm down to the
+// nearest unit: one of y, M, w, d, h, H, m, or s.
+func (dm DateMath) Round(unit string) DateMath {
+	return dm + "/" + DateMath(unit)
+}
+
+var dateMathUnits = []struct {
+	Duration time.Duration
+	Unit     string
+}{
+	{24 * time.Hour, "d"},
+	{time.Hour, "h"},
+	{time.Minute, "m"},
+	{time.Second, "s"},
+}
+
+// formatDateMathDuration formats the non-negative duration d using
+// the largest date math unit that represents it exactly, after
+// rounding up to whole seconds.
+func formatDateMathDuration(d time.Duration) string {
+	if rem := d % time.Second; rem != 0 {
+		d += time.Second - rem
+	}
+	for _, u := range dateMathUnits {
+		if d%u.Duration == 0 {
+			return fmt.Sprintf("%d%s", d/u.Duration, u.Unit)
+		}
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+// WildcardQuery matches documents with field values matching
+// a wildcard pattern, which may contain * and ? characters.
+type WildcardQuery struct {
+	Field           string
+	Value           string
+	CaseInsensitive bool
+	Boost           float64
+}
+
+// NewWildcardQuery returns a WildcardQuery matching field against pattern.
+func NewWildcardQuery(field, pattern string) WildcardQuery {
+	return WildcardQuery{Field: field, Value: pattern}
+}
+
+func (q WildcardQuery) WithCaseInsensitive(v bool) WildcardQuery { q.CaseInsensitive = v; return q }
+func (q WildcardQuery) WithBoost(b float64) WildcardQuery        { q.Boost = b; return q }
+
+func (q WildcardQuery) MarshalJSON() ([]byte, error) {
+	return encodeQueryJSON("wildcard", map[string]any{
+		q.Field: termLevelQuery{Value: q.Value, CaseInsensitive: q.CaseInsensitive, Boost: q.Boost},
+	})
+}
+
+func (q *WildcardQuery) UnmarshalJSON(data []byte) error {
+	var args termLevelQuery
+	field, err := decodeFieldQueryJSON("wildcard", data, &args, &args.Value)
+	if err != nil {
+		return err
+	}
+	*q = WildcardQuery{field, args.Value, args.CaseInsensitive, args.Boost}
+	return nil
+}
+
+// PrefixQuery matches documents with field values starting with a prefix.
+type PrefixQuery struct {
+	Field           string
+	Value           string
+	CaseInsensitive bool
+	Boost           float64
+}
+
+// NewPrefixQuery returns a PrefixQuery matching field against prefix.
+func NewPrefixQuery(field, prefix string) PrefixQuery {
+	return PrefixQuery{Field: field, Value: prefix}
+}
+
+func (q PrefixQuery) WithCaseInsensitive(v bool) PrefixQuery { q.CaseInsensitive = v; return q }
+func (q PrefixQuery) WithBoost(b float64) PrefixQuery        { q.Boost = b; return q }
+
+func (q PrefixQuery) MarshalJSON() ([]byte, error) {
+	return encodeQueryJSON("prefix", map[string]any{
+		q.Field: termLevelQuery{Value: q.Value, CaseInsensitive: q.CaseInsensitive, Boost: q.Boost},
+	})
+}
+
+func (q *PrefixQuery) UnmarshalJSON(data []byte) error {
+	var args termLevelQuery
+	field, err := decodeFieldQueryJSON("prefix", data, &args, &args.Value)
+	if err != nil {
+		return err
+	}
+	*q = PrefixQuery{field, args.Value, args.CaseInsensitive, args.Boost}
+	return nil
+}
+
+// RegexpQuery matches documents with field values matching
+// a regular expression.
+type RegexpQuery struct {
+	Field                 string
+	Value                 string
+	Flags                 string
+	CaseInsensitive       bool
+	MaxDeterminizedStates int
+	Boost                 float64
+}
+
+// NewRegexpQuery returns a RegexpQuery matching field against regexp.
+func NewRegexpQuery(field, regexp string) RegexpQuery {
+	return RegexpQuery{Field: field, Value: regexp}
+}
+
+func (q RegexpQuery) WithFlags(flags string) RegexpQuery     { q.Flags = flags; return q }
+func (q RegexpQuery) WithCaseInsensitive(v bool) RegexpQuery { q.CaseInsensitive = v; return q }
+func (q RegexpQuery) WithMaxDeterminizedStates(n int) RegexpQuery {
+	q.MaxDeterminizedStates = n
+	return q
+}
+func (q RegexpQuery) WithBoost(b float64) RegexpQuery { q.Boost = b; return q }
+
+func (q RegexpQuery) MarshalJSON() ([]byte, error) {
+	return encodeQueryJSON("regexp", map[string]any{
+		q.Field: termLevelQuery{
+			Value:                 q.Value,
+			Flags:                 q.Flags,
+			CaseInsensitive:       q.CaseInsensitive,
+			MaxDeterminizedStates: q.MaxDeterminizedStates,
+			Boost:                 q.Boost,
+		},
+	})
+}
+
+func (q *RegexpQuery) UnmarshalJSON(data []byte) error {
+	var args termLevelQuery
+	field, err := decodeFieldQueryJSON("regexp", data, &args, &args.Value)
+	if err != nil {
+		return err
+	}
+	*q = RegexpQuery{field, args.Value, args.Flags, args.CaseInsensitive, args.MaxDeterminizedStates, args.Boost}
+	return nil
+}
+
+// termLevelQuery holds the arguments common to
+// wildcard, prefix, and regexp queries.
+type termLevelQuery struct {
+	Value                 string  `json:"value"`
+	Flags                 string  `json:"flags,omitempty"`
+	CaseInsensitive       bool    `json:"case_insensitive,omitempty"`
+	MaxDeterminizedStates int     `json:"max_determinized_states,omitempty"`
+	Boost                 float64 `json:"boost,omitempty"`
+}
+
+// IDsQuery matches documents by their _id.
+type IDsQuery struct {
+	Values []string
+}
+
+func (q IDsQuery) MarshalJSON() ([]byte, error) {
+	return encodeQueryJSON("ids", map[string]any{
+		"values": q.Values,
+	})
+}
+
+func (q *IDsQuery) UnmarshalJSON(data []byte) error {
+	var args struct {
+		Values []string `json:"values"`
+	}
+	if err := decodeQueryJSON("ids", data, &args); err != nil {
+		return err
+	}
+	q.Values = args.Values
+	return nil
+}
+
+// MatchQuery matches documents with analyzed field values matching a query.
+type MatchQuery struct {
+	Field              string
+	Query              any
+	Operator           string
+	Fuzziness          string
+	MinimumShouldMatch string
+	Boost              float64
+}
+
+type matchQuery struct {
+	Query              any     `json:"query"`
+	Operator           string  `json:"operator,omitempty"`
+	Fuzziness          string  `json:"fuzziness,omitempty"`
+	MinimumShouldMatch string  `json:"minimum_should_match,omitempty"`
+	Boost              float64 `json:"boost,omitempty"`
+}
+
+// NewMatchQuery returns a MatchQuery matching field against query.
+func NewMatchQuery(field string, query any) MatchQuery {
+	return MatchQuery{Field: field, Query: query}
+}
+
+func (q MatchQuery) WithOperator(op string) MatchQuery          { q.Operator = op; return q }
+func (q MatchQuery) WithFuzziness(f string) MatchQuery          { q.Fuzziness = f; return q }
+func (q MatchQuery) WithMinimumShouldMatch(m string) MatchQuery { q.MinimumShouldMatch = m; return q }
+func (q MatchQuery) WithBoost(b float64) MatchQuery             { q.Boost = b; return q }
+
+func (q MatchQuery) MarshalJSON() ([]byte, error) {
+	return encodeQueryJSON("match", map[string]any{
+		q.Field: matchQuery{q.Query, q.Operator, q.Fuzziness, q.MinimumShouldMatch, q.Boost},
+	})
+}
+
+func (q *MatchQuery) UnmarshalJSON(data []byte) error {
+	var args matchQuery
+	field, err := decodeFieldQueryJSON("match", data, &args, &args.Query)
+	if err != nil {
+		return err
+	}
+	*q = MatchQuery{field, args.Query, args.Operator, args.Fuzziness, args.MinimumShouldMatch, args.Boost}
+	return nil
+}
+
+// QueryStringQuery matches documents using the Lucene query string syntax.
+type QueryStringQuery struct {
+	Query           string
+	DefaultField    string
+	Fields          []string
+	DefaultOperator string
+	AnalyzeWildcard bool
+	Boost           float64
+}
+
+type queryStringQuery struct {
+	Query           string   `json:"query"`
+	DefaultField    string   `json:"default_field,omitempty"`
+	Fields          []string `json:"fields,omitempty"`
+	DefaultOperator string   `json:"default_operator,omitempty"`
+	AnalyzeWildcard bool     `json:"analyze_wildcard,omitempty"`
+	Boost           float64  `json:"boost,omitempty"`
+}
+
+// NewQueryStringQuery returns a QueryStringQuery for query.
+func NewQueryStringQuery(query string) QueryStringQuery {
+	return QueryStringQuery{Query: query}
+}
+
+func (q QueryStringQuery) WithDefaultField(f string) QueryStringQuery   { q.DefaultField = f; return q }
+func (q QueryStringQuery) WithFields(fields ...string) QueryStringQuery { q.Fields = fields; return q }
+func (q QueryStringQuery) WithDefaultOperator(op string) QueryStringQuery {
+	q.DefaultOperator = op
+	return q
+}
+func (q QueryStringQuery) WithAnalyzeWildcard(v bool) QueryStringQuery {
+	q.AnalyzeWildcard = v
+	return q
+}
+func (q QueryStringQuery) WithBoost(b float64) QueryStringQuery { q.Boost = b; return q }
+
+func (q QueryStringQuery) MarshalJSON() ([]byte, error) {
+	return encodeQueryJSON("query_string", queryStringQuery(q))
+}
+
+func (q *QueryStringQuery) UnmarshalJSON(data []byte) error {
+	var args queryStringQuery
+	if err := decodeQueryJSON("query_string", data, &args); err != nil {
+		return err
+	}
+	*q = QueryStringQuery(args)
+	return nil
+}
+
+// NestedQuery matches documents with nested objects matching a query.
+type NestedQuery struct {
+	Path           string
+	Query          any
+	ScoreMode      string
+	IgnoreUnmapped bool
+}
+
+type nestedQuery struct {
+	Path           string `json:"path"`
+	Query          any    `json:"query"`
+	ScoreMode      string `json:"score_mode,omitempty"`
+	IgnoreUnmapped bool   `json:"ignore_unmapped,omitempty"`
+}
+
+// NewNestedQuery returns a NestedQuery matching objects at path against query.
+func NewNestedQuery(path string, query any) NestedQuery {
+	return NestedQuery{Path: path, Query: query}
+}
+
+func (q NestedQuery) WithScoreMode(mode string) NestedQuery { q.ScoreMode = mode; return q }
+func (q NestedQuery) WithIgnoreUnmapped(v bool) NestedQuery { q.IgnoreUnmapped = v; return q }
+
+func (q NestedQuery) MarshalJSON() ([]byte, error) {
+	return encodeQueryJSON("nested", nestedQuery(q))
+}
+
+func (q *NestedQuery) UnmarshalJSON(data []byte) error {
+	var args nestedQuery
+	if err := decodeQueryJSON("nested", data, &args); err != nil {
+		return err
+	}
+	*q = NestedQuery(args)
+	return nil
+}
+
+// HasChildQuery matches parent documents with child documents matching a query.
+type HasChildQuery struct {
+	Type           string
+	Query          any
+	ScoreMode      string
+	MinChildren    int
+	MaxChildren    int
+	IgnoreUnmapped bool
+}
+
+type hasChildQuery struct {
+	Type           string `json:"type"`
+	Query          any    `json:"query"`
+	ScoreMode      string `json:"score_mode,omitempty"`
+	MinChildren    int    `json:"min_children,omitempty"`
+	MaxChildren    int    `json:"max_children,omitempty"`
+	IgnoreUnmapped bool   `json:"ignore_unmapped,omitempty"`
+}
+
+// NewHasChildQuery returns a HasChildQuery matching children of type typ against query.
+func NewHasChildQuery(typ string, query any) HasChildQuery {
+	return HasChildQuery{Type: typ, Query: query}
+}
+
+func (q HasChildQuery) WithScoreMode(mode string) HasChildQuery { q.ScoreMode = mode; return q }
+func (q HasChildQuery) WithMinChildren(n int) HasChildQuery     { q.MinChildren = n; return q }
+func (q HasChildQuery) WithMaxChildren(n int) HasChildQuery     { q.MaxChildren = n; return q }
+func (q HasChildQuery) WithIgnoreUnmapped(v bool) HasChildQuery { q.IgnoreUnmapped = v; return q }
+
+func (q HasChildQuery) MarshalJSON() ([]byte, error) {
+	return encodeQueryJSON("has_child", hasChildQuery(q))
+}
+
+func (q *HasChildQuery) UnmarshalJSON(data []byte) error {
+	var args hasChildQuery
+	if err := decodeQueryJSON("has_child", data, &args); err != nil {
+		return err
+	}
+	*q = HasChildQuery(args)
+	return nil
+}
+
+// ScriptQuery matches documents for which a script returns true.
+type ScriptQuery struct {
+	Source string
+	Lang   string
+	Params map[string]any
+	Boost  float64
+}
+
+type scriptQuery struct {
+	Script struct {
+		Source string         `json:"source"`
+		Lang   string         `json:"lang,omitempty"`
+		Params map[string]any `json:"params,omitempty"`
+	} `json:"script"`
+	Boost float64 `json:"boost,omitempty"`
+}
+
+// NewScriptQuery returns a ScriptQuery for the given script source.
+func NewScriptQuery(source string) ScriptQuery {
+	return ScriptQuery{Source: source}
+}
+
+func (q ScriptQuery) WithLang(lang string) ScriptQuery { q.Lang = lang; return q }
+func (q ScriptQuery) WithBoost(b float64) ScriptQuery  { q.Boost = b; return q }
+
+// WithParam returns a copy of q with the named script parameter set.
+func (q ScriptQuery) WithParam(name string, value any) ScriptQuery {
+	params := make(map[string]any, len(q.Params)+1)
+	for k, v := range q.Params {
+		params[k] = v
+	}
+	params[name] = value
+	q.Params = params
+	return q
+}
+
+func (q ScriptQuery) MarshalJSON() ([]byte, error) {
+	var args scriptQuery
+	args.Script.Source = q.Source
+	args.Script.Lang = q.Lang
+	args.Script.Params = q.Params
+	args.Boost = q.Boost
+	return encodeQueryJSON("script", args)
+}
+
+func (q *ScriptQuery) UnmarshalJSON(data []byte) error {
+	var args scriptQuery
+	if err := decodeQueryJSON("script", data, &args); err != nil {
+		return err
+	}
+	*q = ScriptQuery{args.Script.Source, args.Script.Lang, args.Script.Params, args.Boost}
+	return nil
+}
+
 func encodeQueryJSON(k string, v any) ([]byte, error) {
 	m := map[string]any{k: v}
 	return json.Marshal(m)
 }
+
+// decodeQueryJSON decodes a query of the form {k: v}.
+func decodeQueryJSON(k string, data []byte, v any) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	raw, ok := m[k]
+	if !ok || len(m) != 1 {
+		return fmt.Errorf("expected %q query", k)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// decodeFieldQueryJSON decodes a query of the form {k: {field: v}},
+// returning the field name. If shorthand is non-nil and the field's
+// value is not an object, the value is decoded into shorthand instead.
+func decodeFieldQueryJSON(k string, data []byte, v, shorthand any) (string, error) {
+	var m map[string]json.RawMessage
+	if err := decodeQueryJSON(k, data, &m); err != nil {
+		return "", err
+	}
+	if len(m) != 1 {
+		return "", fmt.Errorf("expected a single field in %q query", k)
+	}
+	var field string
+	var raw json.RawMessage
+	for f, r := range m {
+		field, raw = f, r
+	}
+	if shorthand != nil && !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		return field, json.Unmarshal(raw, shorthand)
+	}
+	return field, json.Unmarshal(raw, v)
+}
@@ -0,0 +1,166 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+func TestQueryJSONRoundTrip(t *testing.T) {
+	for name, test := range map[string]struct {
+		query    json.Marshaler
+		expected string
+	}{
+		"range": {
+			query: espoll.NewRangeQuery("@timestamp").
+				WithGte(espoll.Now().Sub(15 * time.Minute).Round("m")).
+				WithLt(espoll.Now()).
+				WithTimeZone("+01:00"),
+			expected: `{"range":{"@timestamp":{"gte":"now-15m/m","lt":"now","time_zone":"+01:00"}}}`,
+		},
+		"range_numeric": {
+			query:    espoll.NewRangeQuery("transaction.duration.us").WithGt(1000000).WithBoost(2),
+			expected: `{"range":{"transaction.duration.us":{"gt":1000000,"boost":2}}}`,
+		},
+		"range_relation": {
+			query:    espoll.NewRangeQuery("event.duration_range").WithGte(10).WithLte(20).WithRelation("within"),
+			expected: `{"range":{"event.duration_range":{"gte":10,"lte":20,"relation":"within"}}}`,
+		},
+		"wildcard": {
+			query:    espoll.NewWildcardQuery("service.name", "opbeans-*").WithCaseInsensitive(true),
+			expected: `{"wildcard":{"service.name":{"value":"opbeans-*","case_insensitive":true}}}`,
+		},
+		"prefix": {
+			query:    espoll.NewPrefixQuery("transaction.name", "GET /api"),
+			expected: `{"prefix":{"transaction.name":{"value":"GET /api"}}}`,
+		},
+		"regexp": {
+			query:    espoll.NewRegexpQuery("service.name", "opbeans-(go|java)").WithFlags("ALL"),
+			expected: `{"regexp":{"service.name":{"value":"opbeans-(go|java)","flags":"ALL"}}}`,
+		},
+		"ids": {
+			query:    espoll.IDsQuery{Values: []string{"a", "b"}},
+			expected: `{"ids":{"values":["a","b"]}}`,
+		},
+		"match": {
+			query:    espoll.NewMatchQuery("error.exception.message", "connection refused").WithOperator("and"),
+			expected: `{"match":{"error.exception.message":{"query":"connection refused","operator":"and"}}}`,
+		},
+		"query_string": {
+			query: espoll.NewQueryStringQuery("service.name:opbeans* AND NOT event.outcome:success").
+				WithDefaultOperator("AND").
+				WithAnalyzeWildcard(true),
+			expected: `{"query_string":{"query":"service.name:opbeans* AND NOT event.outcome:success","default_operator":"AND","analyze_wildcard":true}}`,
+		},
+		"nested": {
+			query:    espoll.NewNestedQuery("span.links", espoll.TermQuery{Field: "span.links.trace.id", Value: "abc"}).WithScoreMode("none"),
+			expected: `{"nested":{"path":"span.links","query":{"term":{"span.links.trace.id":{"value":"abc"}}},"score_mode":"none"}}`,
+		},
+		"has_child": {
+			query:    espoll.NewHasChildQuery("child", espoll.ExistsQuery{Field: "message"}).WithMinChildren(2),
+			expected: `{"has_child":{"type":"child","query":{"exists":{"field":"message"}},"min_children":2}}`,
+		},
+		"script": {
+			query: espoll.NewScriptQuery("doc['transaction.duration.us'].value > params.min").
+				WithParam("min", 1000),
+			expected: `{"script":{"script":{"source":"doc['transaction.duration.us'].value > params.min","params":{"min":1000}}}}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(test.query)
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expected, string(data))
+
+			decoded := reflect.New(reflect.TypeOf(test.query))
+			require.NoError(t, json.Unmarshal(data, decoded.Interface()))
+			redata, err := json.Marshal(decoded.Elem().Interface())
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expected, string(redata))
+		})
+	}
+}
+
+func TestBoolQueryUnmarshalJSON(t *testing.T) {
+	var q espoll.BoolQuery
+	require.NoError(t, json.Unmarshal([]byte(`{"bool":{
+		"filter": {"term": {"service.name": "svc"}},
+		"should": [{"exists": {"field": "a"}}, {"exists": {"field": "b"}}],
+		"minimum_should_match": 1
+	}}`), &q))
+	assert.Len(t, q.Filter, 1)
+	assert.Len(t, q.Should, 2)
+	assert.Empty(t, q.Must)
+	data, err := json.Marshal(q)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"bool":{
+		"filter": [{"term": {"service.name": "svc"}}],
+		"should": [{"exists": {"field": "a"}}, {"exists": {"field": "b"}}],
+		"minimum_should_match": 1
+	}}`, string(data))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"term":{"service.name":"svc"}}`), &q))
+
+	// Options that BoolQuery cannot represent are rejected.
+	for _, text := range []string{
+		`{"bool":{"filter":[],"_name":"q"}}`,
+		`{"bool":{"adjust_pure_negative":true}}`,
+		`{"bool":{"minimum_should_match":"50%"}}`,
+	} {
+		assert.Error(t, json.Unmarshal([]byte(text), &q), text)
+	}
+}
+
+func TestDateMath(t *testing.T) {
+	for _, test := range []struct {
+		dm       espoll.DateMath
+		expected string
+	}{
+		{espoll.Now().Sub(48 * time.Hour), "now-2d"},
+		{espoll.Now().Sub(90 * time.Minute), "now-90m"},
+		{espoll.Now().Add(61 * time.Second), "now+61s"},
+		{espoll.Now().Add(-time.Hour), "now-1h"},
+		{espoll.Now().Sub(-time.Hour), "now+1h"},
+		// Sub-second durations are rounded up to whole seconds.
+		{espoll.Now().Sub(500 * time.Millisecond), "now-1s"},
+		{espoll.Now().Add(59*time.Second + time.Nanosecond), "now+1m"},
+		{espoll.Now().Add(-1500 * time.Millisecond), "now-2s"},
+		{espoll.Now().Sub(time.Hour).Round("h"), "now-1h/h"},
+	} {
+		assert.Equal(t, test.expected, string(test.dm))
+	}
+}
+
+func TestQueryUnmarshalShorthand(t *testing.T) {
+	var q espoll.WildcardQuery
+	require.NoError(t, json.Unmarshal([]byte(`{"wildcard":{"service.name":"opbeans-*"}}`), &q))
+	assert.Equal(t, espoll.NewWildcardQuery("service.name", "opbeans-*"), q)
+
+	var m espoll.MatchQuery
+	require.NoError(t, json.Unmarshal([]byte(`{"match":{"message":"hello"}}`), &m))
+	assert.Equal(t, espoll.NewMatchQuery("message", "hello"), m)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"prefix":{"a":"b"}}`), &q))
+}
@@ -18,6 +18,7 @@
 package espoll
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -29,46 +30,148 @@ import (
 
 // SearchIndexMinDocs searches index with query, returning the results.
 //
-// If the search returns fewer than min results within 10 seconds
-// (by default), SearchIndexMinDocs will return an error.
+// The search is repeated until the total number of matching documents,
+// which is tracked exactly, is at least min. If this does not happen
+// within 10 seconds (by default), SearchIndexMinDocs will return an error.
+//
+// Each search requests up to min hits (at least 10, and at most 10000),
+// so polling does not depend on the number of hits returned. Once min
+// is reached, if more documents match than were returned, all of them
+// are fetched with SearchRequest.SearchAll in a single pass without
+// further polling, so the result holds every matching document.
 func (es *Client) SearchIndexMinDocs(
 	ctx context.Context,
 	min int, index string,
 	query json.Marshaler,
 	opts ...RequestOption,
 ) (SearchResult, error) {
-	var result SearchResult
-	req := es.NewSearchRequest(index)
-	req.ExpandWildcards = "open,hidden"
-	if min > 10 {
+	return es.newIndexSearchRequest(index, query).SearchMinDocs(ctx, min, opts...)
+}
+
+// IterateIndexMinDocs waits for index to contain at least min documents
+// matching query, like SearchIndexMinDocs, and then calls fn for each
+// matching document using SearchRequest.Iterate.
+func (es *Client) IterateIndexMinDocs(
+	ctx context.Context,
+	min int, index string,
+	query json.Marshaler,
+	fn func(SearchHit) error,
+	opts ...RequestOption,
+) error {
+	return es.newIndexSearchRequest(index, query).IterateMinDocs(ctx, min, fn, opts...)
+}
+
+// SearchMinDocs is like SearchIndexMinDocs, but issues r, so that the
+// hits may be shaped with r's With* methods; for example, restricting
+// their fields or _source. If r's Size is unset, it is derived from min
+// as for SearchIndexMinDocs. Total hits are always tracked exactly.
+func (r *SearchRequest) SearchMinDocs(ctx context.Context, min int, opts ...RequestOption) (SearchResult, error) {
+	if r.Size == nil {
 		// Size defaults to 10. If the caller expects more than 10,
 		// return it in the search so we don't have to search again.
-		req = req.WithSize(min)
+		size := min
+		switch {
+		case size < 10:
+			size = 10
+		case size > maxResultWindow:
+			size = maxResultWindow
+		}
+		if size != 10 {
+			r = r.WithSize(size)
+		}
 	}
+	result, err := r.waitMinDocs(ctx, min, opts...)
+	if err != nil {
+		return result, r.diagnose(ctx, err, opts)
+	}
+	if len(result.Hits.Hits) < result.Hits.Total.Value {
+		all, err := r.SearchAll(ctx)
+		if err != nil {
+			return result, err
+		}
+		result.Hits = all.Hits
+	}
+	return result, nil
+}
+
+// IterateMinDocs is like IterateIndexMinDocs, but iterates over the
+// hits of r, using its Size, if set, as the page size.
+func (r *SearchRequest) IterateMinDocs(
+	ctx context.Context,
+	min int,
+	fn func(SearchHit) error,
+	opts ...RequestOption,
+) error {
+	size := r.Size
+	r = r.WithSize(0)
+	_, err := r.waitMinDocs(ctx, min, opts...)
+	r.Size = size
+	if err != nil {
+		return r.diagnose(ctx, err, opts)
+	}
+	return r.Iterate(ctx, fn)
+}
+
+// newIndexSearchRequest returns a search request for documents
+// matching query in index, including hidden indices.
+func (es *Client) newIndexSearchRequest(index string, query json.Marshaler) *SearchRequest {
+	req := es.NewSearchRequest(index)
+	req.ExpandWildcards = "open,hidden"
 	if query != nil {
 		req = req.WithQuery(query)
 	}
-	opts = append(opts, WithCondition(AllCondition(
-		result.Hits.MinHitsCondition(min),
-		result.Hits.TotalHitsCondition(req),
-	)))
+	return req
+}
+
+// waitMinDocs issues r until the total number of hits is at least min.
+func (r *SearchRequest) waitMinDocs(ctx context.Context, min int, opts ...RequestOption) (SearchResult, error) {
+	var result SearchResult
+	r = r.WithTrackTotalHits(true)
+	opts = append(opts, WithCondition(result.Hits.MinTotalHitsCondition(min)))
 
 	// Refresh the indices before issuing the search request.
+	if err := r.es.refresh(ctx, strings.Join(r.Index, ",")); err != nil {
+		return result, err
+	}
+
+	if _, err := r.Do(ctx, &result, opts...); err != nil {
+		return result, fmt.Errorf("failed issuing request: %w", err)
+	}
+	return result, nil
+}
+
+// diagnose diagnoses err, returned from issuing r, as for Client.diagnose.
+func (r *SearchRequest) diagnose(ctx context.Context, err error, opts []RequestOption) error {
+	var query json.Marshaler
+	switch q := r.body.Query.(type) {
+	case nil:
+	case json.Marshaler:
+		query = q
+	default:
+		query = anyMarshaler{q}
+	}
+	return r.es.diagnose(ctx, err, strings.Join(r.Index, ","), query, opts)
+}
+
+// anyMarshaler marshals its value with encoding/json.
+type anyMarshaler struct{ v any }
+
+func (m anyMarshaler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.v)
+}
+
+// refresh refreshes the comma-separated list of indices.
+func (es *Client) refresh(ctx context.Context, index string) error {
 	refreshReq := esapi.IndicesRefreshRequest{
-		Index:           strings.Split(",", index),
+		Index:           strings.Split(index, ","),
 		ExpandWildcards: "all",
 	}
-	rsp, err := refreshReq.Do(ctx, es.Transport)
+	rsp, err := refreshReq.Do(ctx, es)
 	if err != nil {
-		return result, fmt.Errorf("failed refreshing indices: %s: %w", index, err)
+		return fmt.Errorf("failed refreshing indices: %s: %w", index, err)
 	}
-
 	rsp.Body.Close()
-
-	if _, err := req.Do(ctx, &result, opts...); err != nil {
-		return result, fmt.Errorf("failed issuing request: %w", err)
-	}
-	return result, nil
+	return nil
 }
 
 // NewSearchRequest returns a search request using the wrapped Elasticsearch
@@ -76,27 +179,174 @@ func (es *Client) SearchIndexMinDocs(
 func (es *Client) NewSearchRequest(index string) *SearchRequest {
 	req := &SearchRequest{es: es}
 	req.Index = strings.Split(index, ",")
-	req.Body = strings.NewReader(`{"fields": ["*"]}`)
+	req.updateBody()
 	return req
 }
 
 // SearchRequest wraps an esapi.SearchRequest with a Client.
+//
+// The request body is composed from the values passed to the
+// SearchRequest's With* methods; each method sets one part of
+// the body, leaving the others unchanged. Unless WithFields is
+// called, the body requests all fields with `"fields": ["*"]`.
 type SearchRequest struct {
 	esapi.SearchRequest
-	es *Client
+	es   *Client
+	body searchBody
+}
+
+// searchBody holds the parts of a search request body that
+// may be set with SearchRequest methods.
+type searchBody struct {
+	Query           any                     `json:"query,omitempty"`
+	Source          any                     `json:"_source,omitempty"`
+	Fields          []string                `json:"fields,omitempty"`
+	RuntimeMappings map[string]RuntimeField `json:"runtime_mappings,omitempty"`
+	Collapse        *Collapse               `json:"collapse,omitempty"`
+	TrackTotalHits  any                     `json:"track_total_hits,omitempty"`
+	Aggregations    map[string]any          `json:"aggs,omitempty"`
+	PostFilter      any                     `json:"post_filter,omitempty"`
 }
 
+// WithQuery sets the query of the search request.
 func (r *SearchRequest) WithQuery(q any) *SearchRequest {
-	var body struct {
-		Query  any      `json:"query"`
-		Fields []string `json:"fields"`
+	r.body.Query = q
+	r.updateBody()
+	return r
+}
+
+// WithAggregation adds a named aggregation to the search request.
+func (r *SearchRequest) WithAggregation(name string, agg any) *SearchRequest {
+	if r.body.Aggregations == nil {
+		r.body.Aggregations = make(map[string]any)
 	}
-	body.Query = q
-	body.Fields = []string{"*"}
-	r.Body = esutil.NewJSONReader(&body)
+	r.body.Aggregations[name] = agg
+	r.updateBody()
+	return r
+}
+
+// WithSource controls whether hits include their _source.
+func (r *SearchRequest) WithSource(enabled bool) *SearchRequest {
+	r.body.Source = enabled
+	r.updateBody()
+	return r
+}
+
+// WithSourceFilter limits the _source returned for each hit to the
+// fields matching includes, and not matching excludes. Either may be
+// empty, and both may contain wildcards.
+func (r *SearchRequest) WithSourceFilter(includes, excludes []string) *SearchRequest {
+	r.body.Source = SourceFilter{Includes: includes, Excludes: excludes}
+	r.updateBody()
+	return r
+}
+
+// WithFields sets the fields returned for each hit, which may contain
+// wildcards. Calling WithFields with no arguments disables the fields
+// option, so only _source is returned.
+func (r *SearchRequest) WithFields(fields ...string) *SearchRequest {
+	r.body.Fields = append([]string{}, fields...)
+	r.updateBody()
+	return r
+}
+
+// WithRuntimeField adds a runtime field to the search request,
+// which may be queried, aggregated, and returned in fields.
+func (r *SearchRequest) WithRuntimeField(name string, field RuntimeField) *SearchRequest {
+	if r.body.RuntimeMappings == nil {
+		r.body.RuntimeMappings = make(map[string]RuntimeField)
+	}
+	r.body.RuntimeMappings[name] = field
+	r.updateBody()
+	return r
+}
+
+// WithCollapse collapses search results by a single-valued field.
+func (r *SearchRequest) WithCollapse(collapse Collapse) *SearchRequest {
+	r.body.Collapse = &collapse
+	r.updateBody()
+	return r
+}
+
+// WithTrackTotalHits controls whether the total number of hits is
+// counted accurately. When disabled, Hits.Total is not returned.
+func (r *SearchRequest) WithTrackTotalHits(enabled bool) *SearchRequest {
+	r.body.TrackTotalHits = enabled
+	r.updateBody()
+	return r
+}
+
+// WithTrackTotalHitsUpTo counts the total number of hits accurately
+// up to n. Beyond that, Hits.Total is a lower bound.
+func (r *SearchRequest) WithTrackTotalHitsUpTo(n int) *SearchRequest {
+	r.body.TrackTotalHits = n
+	r.updateBody()
+	return r
+}
+
+// WithPostFilter sets a query used to filter hits after
+// aggregations have been calculated.
+func (r *SearchRequest) WithPostFilter(q any) *SearchRequest {
+	r.body.PostFilter = q
+	r.updateBody()
 	return r
 }
 
+func (r *SearchRequest) updateBody() {
+	body := r.body
+	if body.Fields == nil {
+		body.Fields = []string{"*"}
+	}
+	r.Body = esutil.NewJSONReader(&body)
+}
+
+// SourceFilter holds _source filtering options for a search request.
+type SourceFilter struct {
+	Includes []string `json:"includes,omitempty"`
+	Excludes []string `json:"excludes,omitempty"`
+}
+
+// RuntimeField defines a field computed at search time.
+type RuntimeField struct {
+	// Type holds the field type, e.g. "keyword" or "long".
+	Type string `json:"type"`
+
+	// Script holds a Painless script which emits the field's values.
+	// If Script is empty, the field's value is read from _source.
+	Script string `json:"-"`
+}
+
+func (f RuntimeField) MarshalJSON() ([]byte, error) {
+	type script struct {
+		Source string `json:"source"`
+	}
+	var args struct {
+		Type   string  `json:"type"`
+		Script *script `json:"script,omitempty"`
+	}
+	args.Type = f.Type
+	if f.Script != "" {
+		args.Script = &script{Source: f.Script}
+	}
+	return json.Marshal(args)
+}
+
+// Collapse holds field collapsing options for a search request.
+type Collapse struct {
+	// Field holds the name of the field to collapse by.
+	Field string `json:"field"`
+
+	// InnerHits optionally requests the top hits of each group.
+	InnerHits *InnerHits `json:"inner_hits,omitempty"`
+}
+
+// InnerHits holds options for the inner hits of a collapsed group.
+type InnerHits struct {
+	Name string   `json:"name"`
+	Size int      `json:"size,omitempty"`
+	Sort []string `json:"sort,omitempty"`
+}
+
 func (r *SearchRequest) WithSort(fieldDirection ...string) *SearchRequest {
 	r.Sort = fieldDirection
 	return r
@@ -112,8 +362,8 @@ func (r *SearchRequest) Do(ctx context.Context, out *SearchResult, opts ...Reque
 }
 
 type SearchResult struct {
-	Hits         SearchHits                 `json:"hits"`
-	Aggregations map[string]json.RawMessage `json:"aggregations"`
+	Hits         SearchHits   `json:"hits"`
+	Aggregations Aggregations `json:"aggregations"`
 }
 
 type SearchHits struct {
@@ -137,6 +387,12 @@ func (h *SearchHits) MinHitsCondition(min int) ConditionFunc {
 	return func(*esapi.Response) bool { return len(h.Hits) >= min }
 }
 
+// MinTotalHitsCondition returns a ConditionFunc which will return true if h.Total.Value
+// is at least min. Unlike MinHitsCondition, this does not require the hits to be returned.
+func (h *SearchHits) MinTotalHitsCondition(min int) ConditionFunc {
+	return func(*esapi.Response) bool { return h.Total.Value >= min }
+}
+
 // TotalHitsCondition returns a ConditionFunc which will return true if the number of h.Hits
 // is at least h.Total.Value. If the condition returns false, it will update req.Size to
 // accommodate the number of hits in the following search.
@@ -155,6 +411,7 @@ type SearchHit struct {
 	Index     string
 	ID        string
 	Score     float64
+	Sort      []any
 	Fields    map[string][]any
 	Source    map[string]any
 	RawSource json.RawMessage
@@ -166,6 +423,7 @@ func (h *SearchHit) UnmarshalJSON(data []byte) error {
 		Index  string          `json:"_index"`
 		ID     string          `json:"_id"`
 		Score  float64         `json:"_score"`
+		Sort   json.RawMessage `json:"sort"`
 		Source json.RawMessage `json:"_source"`
 		Fields json.RawMessage `json:"fields"`
 	}
@@ -175,15 +433,31 @@ func (h *SearchHit) UnmarshalJSON(data []byte) error {
 	h.Index = searchHit.Index
 	h.ID = searchHit.ID
 	h.Score = searchHit.Score
+	h.Sort = nil
+	if len(searchHit.Sort) > 0 {
+		// Decode sort values as json.Number to avoid loss
+		// of precision when passing them to search_after.
+		dec := json.NewDecoder(bytes.NewReader(searchHit.Sort))
+		dec.UseNumber()
+		if err := dec.Decode(&h.Sort); err != nil {
+			return fmt.Errorf("error unmarshaling sort: %w", err)
+		}
+	}
 	h.RawSource = searchHit.Source
 	h.RawFields = searchHit.Fields
 	h.Source = make(map[string]any)
 	h.Fields = make(map[string][]interface{})
-	if err := json.Unmarshal(h.RawSource, &h.Source); err != nil {
-		return fmt.Errorf("error unmarshaling _source: %w", err)
+	// _source is omitted if disabled with WithSource(false),
+	// and fields is omitted if no requested fields are present.
+	if len(h.RawSource) > 0 {
+		if err := json.Unmarshal(h.RawSource, &h.Source); err != nil {
+			return fmt.Errorf("error unmarshaling _source: %w", err)
+		}
 	}
-	if err := json.Unmarshal(h.RawFields, &h.Fields); err != nil {
-		return fmt.Errorf("error unmarshaling fields: %w", err)
+	if len(h.RawFields) > 0 {
+		if err := json.Unmarshal(h.RawFields, &h.Fields); err != nil {
+			return fmt.Errorf("error unmarshaling fields: %w", err)
+		}
 	}
 	return nil
 }
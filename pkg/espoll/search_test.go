@@ -0,0 +1,114 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package espoll_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-tools/pkg/espoll"
+)
+
+func TestSearchRequestBody(t *testing.T) {
+	es := espoll.WrapClient(nil)
+	body, err := io.ReadAll(es.NewSearchRequest("traces-apm*").Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"fields": ["*"]}`, string(body))
+
+	req := es.NewSearchRequest("traces-apm*").
+		WithSourceFilter([]string{"trace.*"}, nil).
+		WithQuery(espoll.TermQuery{Field: "processor.event", Value: "transaction"}).
+		WithFields("service.name", "duration").
+		WithRuntimeField("duration", espoll.RuntimeField{
+			Type:   "long",
+			Script: "emit(doc['transaction.duration.us'].value)",
+		}).
+		WithCollapse(espoll.Collapse{Field: "trace.id"}).
+		WithTrackTotalHitsUpTo(100).
+		WithAggregation("services", espoll.NewTermsAggregation("service.name")).
+		WithPostFilter(espoll.TermQuery{Field: "event.outcome", Value: "failure"})
+	body, err = io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"query": {"term": {"processor.event": {"value": "transaction"}}},
+		"_source": {"includes": ["trace.*"]},
+		"fields": ["service.name", "duration"],
+		"runtime_mappings": {
+			"duration": {"type": "long", "script": {"source": "emit(doc['transaction.duration.us'].value)"}}
+		},
+		"collapse": {"field": "trace.id"},
+		"track_total_hits": 100,
+		"aggs": {"services": {"terms": {"field": "service.name"}}},
+		"post_filter": {"term": {"event.outcome": {"value": "failure"}}}
+	}`, string(body))
+
+	body, err = io.ReadAll(req.WithSource(false).WithFields().Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"_source":false`)
+	assert.NotContains(t, string(body), `"fields"`)
+}
+
+func TestSearchHitUnmarshalJSONMissing(t *testing.T) {
+	var hit espoll.SearchHit
+	require.NoError(t, json.Unmarshal([]byte(`{"_index":"index","_id":"1"}`), &hit))
+	assert.Equal(t, "1", hit.ID)
+	assert.Empty(t, hit.Source)
+	assert.Empty(t, hit.Fields)
+	assert.Nil(t, hit.RawSource)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"_index":"index","_id":"2","fields":{"a":[1]}}`), &hit))
+	assert.Equal(t, map[string][]any{"a": {float64(1)}}, hit.Fields)
+	assert.Empty(t, hit.Source)
+}
+
+func TestSearchMinDocs(t *testing.T) {
+	var searches []string
+	es := newTestClient(func(req *http.Request) (int, string) {
+		if req.URL.Path == "/index/_refresh" {
+			return http.StatusOK, `{}`
+		}
+		searches = append(searches, string(readBody(req)))
+		if len(searches) == 1 {
+			return http.StatusOK, `{"hits": {"total": {"value": 1, "relation": "eq"}, "hits": []}}`
+		}
+		return http.StatusOK, `{"hits": {"total": {"value": 2, "relation": "eq"}, "hits": [
+			{"_index": "index", "_id": "1", "fields": {"service.name": ["svc"]}},
+			{"_index": "index", "_id": "2", "fields": {"service.name": ["svc"]}}
+		]}}`
+	})
+
+	// The request's fields and _source options are preserved while polling.
+	result, err := es.NewSearchRequest("index").
+		WithFields("service.name").
+		WithSource(false).
+		SearchMinDocs(context.Background(), 2, espoll.WithInterval(time.Millisecond))
+	require.NoError(t, err)
+	require.Len(t, result.Hits.Hits, 2)
+	assert.Equal(t, []any{"svc"}, result.Hits.Hits[0].Fields["service.name"])
+	require.Len(t, searches, 2)
+	for _, body := range searches {
+		assert.JSONEq(t, `{"fields": ["service.name"], "_source": false, "track_total_hits": true}`, body)
+	}
+}